@@ -0,0 +1,127 @@
+package router
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Paths of the admin endpoints
+const (
+	adminReloadPath = "/__admin/reload"
+	adminRoutesPath = "/__admin/routes"
+	adminHealthPath = "/__admin/health"
+)
+
+// Address the admin server binds when no host is configured, keeping it off public interfaces
+const defaultAdminHost = "127.0.0.1"
+
+// AdminConfig serves authenticated operational endpoints on a port of their own
+type AdminConfig struct {
+	Port  int    `mapstructure:"port"`  // Port of the admin server, disabled when zero
+	Host  string `mapstructure:"host"`  // Address to bind, defaults to 127.0.0.1
+	Token string `mapstructure:"token"` // Bearer token required by every admin request
+}
+
+// enabled reports whether the admin server is started
+func (a AdminConfig) enabled() bool {
+	return a.Port != 0
+}
+
+// validate checks that the admin server has a usable port and a token
+func (a AdminConfig) validate() error {
+	if a.Port < 1 || a.Port > 65535 {
+		return fmt.Errorf("admin port %d must be between 1 and 65535", a.Port)
+	}
+	if len(a.Token) == 0 {
+		return errors.New("admin requires a token")
+	}
+	return nil
+}
+
+// address returns the address the admin server listens on
+func (a AdminConfig) address() string {
+	host := a.Host
+	if len(host) == 0 {
+		host = defaultAdminHost
+	}
+	return net.JoinHostPort(host, strconv.Itoa(a.Port))
+}
+
+// newAdminServer creates the admin server, reload reloads the config like SIGHUP and live holds the
+// configs of the running servers, ready the readiness reported on the health endpoint
+func newAdminServer(cfg AdminConfig, reload func() error, live map[int]*liveServer, ready *atomic.Bool) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc(adminReloadPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		logger.Infof("Received admin reload request, reloading config and certificates...")
+		if err := reload(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("Reloaded\n"))
+	})
+	mux.HandleFunc(adminRoutesPath, func(w http.ResponseWriter, r *http.Request) {
+		ports := make([]int, 0, len(live))
+		for port := range live {
+			ports = append(ports, port)
+		}
+		slices.Sort(ports)
+
+		tables := make([]debugServer, 0, len(ports))
+		for _, port := range ports {
+			tables = append(tables, newRoutingTable(*live[port].Load()))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(tables)
+	})
+	mux.HandleFunc(adminHealthPath, healthzHandler(ready))
+
+	return &http.Server{Addr: cfg.address(), Handler: requireToken(cfg.Token, mux)}
+}
+
+// requireToken rejects requests without the bearer token
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			logger.Errorf("Unauthorized admin request from %s: %s", remoteIP(r), r.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="router admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// reloader serializes config reloads requested by SIGHUP and the admin server
+type reloader struct {
+	mu    sync.Mutex
+	load  func() (Config, error)
+	live  map[int]*liveServer
+	certs *certStores
+}
+
+// reload reloads the config and the certificates of HTTPS servers
+func (l *reloader) reload() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	err := reloadConfig(l.load, l.live)
+	l.certs.reload()
+	return err
+}
@@ -0,0 +1,37 @@
+package router
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// AutocertConfig obtains and renews the certificates of a server from Let's Encrypt through ACME
+type AutocertConfig struct {
+	Enabled  bool     `mapstructure:"enabled"`
+	Hosts    []string `mapstructure:"hosts"`     // Host names certificates are requested for, other names are refused
+	CacheDir string   `mapstructure:"cache_dir"` // Directory the account key and certificates are stored in
+	Email    string   `mapstructure:"email"`     // Contact address for expiry notices, optional
+}
+
+// validate checks that the hosts and the cache directory are configured
+func (a AutocertConfig) validate() error {
+	if len(a.Hosts) == 0 {
+		return errors.New("tls autocert requires hosts")
+	}
+	if len(a.CacheDir) == 0 {
+		return errors.New("tls autocert requires cache_dir")
+	}
+	return nil
+}
+
+// manager returns the ACME manager of the config. Certificates are obtained through the TLS-ALPN-01
+// challenge on the first handshake for a host and renewed before they expire.
+func (a AutocertConfig) manager() *autocert.Manager {
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(a.Hosts...),
+		Cache:      autocert.DirCache(a.CacheDir),
+		Email:      a.Email,
+	}
+}
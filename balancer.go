@@ -0,0 +1,205 @@
+package router
+
+import (
+	"context"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Load balancing strategies for routes with multiple targets
+const (
+	StrategyRoundRobin = "round_robin"
+	StrategyRandom     = "random"
+)
+
+// Roles of a target
+const (
+	RolePrimary = "primary"
+	RoleBackup  = "backup"
+)
+
+// Duration a failed target is avoided unless configured otherwise
+const defaultFailTimeout = 10 * time.Second
+
+// TargetConfig describes a single backend of a route
+type TargetConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Role     string `mapstructure:"role"`      // primary (default) or backup
+	MaxConns int    `mapstructure:"max_conns"` // Requests in flight to the target at once, unlimited when zero
+}
+
+// hostname returns the target host without IPv6 brackets, defaulting to localhost
+func (t TargetConfig) hostname() string {
+	if len(t.Host) == 0 {
+		return "localhost"
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(t.Host, "["), "]")
+}
+
+// String returns the host:port address of the target, IPv6 literals are wrapped in brackets
+func (t TargetConfig) String() string {
+	return net.JoinHostPort(t.hostname(), strconv.Itoa(t.Port))
+}
+
+// balancer selects targets for a route according to its strategy. Primary targets take all traffic,
+// backups are only used when every primary recently failed.
+type balancer struct {
+	targets     []TargetConfig
+	strategy    string
+	failTimeout time.Duration
+	counter     atomic.Uint64
+
+	mu        sync.Mutex
+	downUntil map[TargetConfig]time.Time
+	inFlight  map[TargetConfig]*atomic.Int64
+
+	freed chan struct{} // Signaled when a connection slot is released, wakes one queued request
+}
+
+// newBalancer creates a balancer for the targets of the route
+func newBalancer(route RedirectConfig) *balancer {
+	return newTargetBalancer(route.targetList(), route.Strategy, route.FailTimeout)
+}
+
+// newTargetBalancer creates a balancer for the targets, failed targets are avoided for failTimeout
+func newTargetBalancer(targets []TargetConfig, strategy string, failTimeout time.Duration) *balancer {
+	if failTimeout <= 0 {
+		failTimeout = defaultFailTimeout
+	}
+
+	b := &balancer{
+		targets:     targets,
+		strategy:    strategy,
+		failTimeout: failTimeout,
+		downUntil:   make(map[TargetConfig]time.Time),
+		inFlight:    make(map[TargetConfig]*atomic.Int64, len(targets)),
+		freed:       make(chan struct{}, 1),
+	}
+	for _, target := range targets {
+		b.inFlight[target] = &atomic.Int64{}
+	}
+	return b
+}
+
+// pick returns the target that should serve the next request
+func (b *balancer) pick() TargetConfig {
+	return b.order()[0]
+}
+
+// order returns all targets in the order they should be tried: available primaries starting with the one
+// selected by the strategy, then available backups, then the targets that recently failed
+func (b *balancer) order() []TargetConfig {
+	var primaries, backups, failed []TargetConfig
+
+	now := time.Now()
+	b.mu.Lock()
+	for _, target := range b.targets {
+		switch {
+		case now.Before(b.downUntil[target]):
+			failed = append(failed, target)
+		case target.Role == RoleBackup:
+			backups = append(backups, target)
+		default:
+			primaries = append(primaries, target)
+		}
+	}
+	b.mu.Unlock()
+
+	targets := make([]TargetConfig, 0, len(b.targets))
+	targets = append(targets, b.rotate(primaries)...)
+	targets = append(targets, b.rotate(backups)...)
+	return append(targets, failed...)
+}
+
+// acquire reserves a connection slot on the first target in order that has capacity left
+func (b *balancer) acquire() (TargetConfig, bool) {
+	for _, target := range b.order() {
+		if b.tryAcquire(target) {
+			return target, true
+		}
+	}
+	return TargetConfig{}, false
+}
+
+// tryAcquire reserves a connection slot on the target unless it reached its connection limit
+func (b *balancer) tryAcquire(target TargetConfig) bool {
+	inFlight := b.inFlight[target]
+	if inFlight.Add(1) > int64(target.MaxConns) && target.MaxConns > 0 {
+		inFlight.Add(-1)
+		return false
+	}
+	return true
+}
+
+// acquireWait reserves a connection slot like acquire, waiting for a slot to be released until the context is done
+func (b *balancer) acquireWait(ctx context.Context) (TargetConfig, bool) {
+	for {
+		if target, ok := b.acquire(); ok {
+			// Another slot may be free as well, let the next queued request check
+			b.signalFreed()
+			return target, true
+		}
+		select {
+		case <-b.freed:
+		case <-ctx.Done():
+			return TargetConfig{}, false
+		}
+	}
+}
+
+// release frees the connection slot reserved on the target
+func (b *balancer) release(target TargetConfig) {
+	b.inFlight[target].Add(-1)
+	b.signalFreed()
+}
+
+// signalFreed wakes a queued request, if any, to check for a free connection slot
+func (b *balancer) signalFreed() {
+	select {
+	case b.freed <- struct{}{}:
+	default:
+	}
+}
+
+// markFailed avoids the target until the fail timeout has passed
+func (b *balancer) markFailed(target TargetConfig) {
+	b.mu.Lock()
+	b.downUntil[target] = time.Now().Add(b.failTimeout)
+	b.mu.Unlock()
+}
+
+// downTime returns the time until which the target is avoided after a failure, false when it is healthy
+func (b *balancer) downTime(target TargetConfig) (time.Time, bool) {
+	b.mu.Lock()
+	until := b.downUntil[target]
+	b.mu.Unlock()
+	return until, time.Now().Before(until)
+}
+
+// rotate returns the targets starting with the one selected by the strategy
+func (b *balancer) rotate(targets []TargetConfig) []TargetConfig {
+	if len(targets) == 0 {
+		return nil
+	}
+
+	start := b.next(len(targets))
+	rotated := make([]TargetConfig, 0, len(targets))
+	for i := range targets {
+		rotated = append(rotated, targets[(start+i)%len(targets)])
+	}
+	return rotated
+}
+
+// next returns the index of the selected target out of n
+func (b *balancer) next(n int) int {
+	if b.strategy == StrategyRandom {
+		return rand.IntN(n)
+	}
+	return int((b.counter.Add(1) - 1) % uint64(n))
+}
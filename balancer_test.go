@@ -0,0 +1,73 @@
+package router
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestTargetURL(t *testing.T) {
+	tests := []struct {
+		host     string
+		wantHost string
+		wantAddr string
+	}{
+		{"::1", "::1", "[::1]:8080"},
+		{"[::1]", "::1", "[::1]:8080"},
+		{"2001:db8::1", "2001:db8::1", "[2001:db8::1]:8080"},
+		{"127.0.0.1", "127.0.0.1", "127.0.0.1:8080"},
+		{"backend.internal", "backend.internal", "backend.internal:8080"},
+		{"", "localhost", "localhost:8080"},
+	}
+	for _, tt := range tests {
+		target := TargetConfig{Host: tt.host, Port: 8080}
+		if got := target.String(); got != tt.wantAddr {
+			t.Errorf("host %q: got address %q, want %q", tt.host, got, tt.wantAddr)
+		}
+		for _, scheme := range []string{"http", "ws"} {
+			u, err := url.Parse(scheme + "://" + target.String() + "/path")
+			if err != nil {
+				t.Errorf("host %q: %v", tt.host, err)
+				continue
+			}
+			if u.Hostname() != tt.wantHost || u.Port() != "8080" {
+				t.Errorf("host %q: parsed %s URL host %q port %q, want %q 8080", tt.host, scheme, u.Hostname(), u.Port(), tt.wantHost)
+			}
+		}
+	}
+}
+
+func TestIPv6Backend(t *testing.T) {
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ipv6 "+r.URL.Path)
+	}))
+	backend.Listener = listener
+	backend.Start()
+	defer backend.Close()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	log := false
+	for _, host := range []string{"::1", "[::1]"} {
+		server := prepareServer(t, Config{Router: []ServerConfig{{
+			Server: 8080,
+			Redirect: []RedirectConfig{{
+				Path:    "/",
+				Targets: []TargetConfig{{Host: host, Port: port}},
+				Log:     &log,
+			}},
+		}}})
+
+		rec := httptest.NewRecorder()
+		server.Redirect[0].handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v6", nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != "ipv6 /v6" {
+			t.Errorf("host %q: got %d %q, want 200 %q", host, rec.Code, rec.Body.String(), "ipv6 /v6")
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package router
+
+import (
+	"bytes"
+	"io"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Bytes of each body logged unless configured otherwise
+const defaultBodyLogMaxSize = 4096
+
+// BodyLogConfig logs request and response headers and bodies of a route for debugging
+type BodyLogConfig struct {
+	Enabled      bool     `mapstructure:"enabled"`
+	MaxSize      int      `mapstructure:"max_size"`      // Bytes of each body logged, defaults to 4KiB
+	RedactFields []string `mapstructure:"redact_fields"` // JSON fields and form parameters whose values are hidden
+}
+
+// bodyRedactor hides the values of JSON fields and form parameters in logged bodies. Logged bodies may be
+// truncated, so values are replaced textually instead of by parsing the body.
+type bodyRedactor struct {
+	patterns []*regexp.Regexp
+}
+
+// newBodyRedactor creates a redactor for the field names, falling back to the redacted query parameters
+func newBodyRedactor(fields []string) *bodyRedactor {
+	if len(fields) == 0 {
+		fields = defaultRedactQuery
+	}
+
+	r := &bodyRedactor{}
+	for _, field := range fields {
+		name := regexp.QuoteMeta(field)
+		r.patterns = append(r.patterns,
+			regexp.MustCompile(`(?i)("`+name+`"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\]\s]+)`),
+			regexp.MustCompile(`(?i)((?:^|&)`+name+`=)[^&]*`),
+		)
+	}
+	return r
+}
+
+// redact returns the body with the values of sensitive fields replaced
+func (r *bodyRedactor) redact(body []byte) []byte {
+	for i, pattern := range r.patterns {
+		replacement := []byte("${1}" + redactedValue)
+		if i%2 == 0 {
+			replacement = []byte(`${1}"` + redactedValue + `"`)
+		}
+		body = pattern.ReplaceAll(body, replacement)
+	}
+	return body
+}
+
+// bodyLogger passes a body through unchanged while keeping its first bytes, which are logged once the body
+// was read completely or closed
+type bodyLogger struct {
+	io.ReadCloser
+	limit int
+	buf   bytes.Buffer
+	total int64
+	once  sync.Once
+	write func(captured []byte, total int64)
+}
+
+func (b *bodyLogger) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.total += int64(n)
+	if room := b.limit - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(n, room)])
+	}
+	if err == io.EOF {
+		b.flush()
+	}
+	return n, err
+}
+
+func (b *bodyLogger) Close() error {
+	b.flush()
+	return b.ReadCloser.Close()
+}
+
+func (b *bodyLogger) flush() {
+	b.once.Do(func() { b.write(b.buf.Bytes(), b.total) })
+}
+
+// wrap returns the body logging itself under the description, or the body unchanged when it has no content
+func (c BodyLogConfig) wrap(body io.ReadCloser, header http.Header, redactor *bodyRedactor, description string) io.ReadCloser {
+	if body == nil || body == http.NoBody {
+		return body
+	}
+
+	limit := c.MaxSize
+	if limit <= 0 {
+		limit = defaultBodyLogMaxSize
+	}
+	encoding := header.Get("Content-Encoding")
+	return &bodyLogger{
+		ReadCloser: body,
+		limit:      limit,
+		write: func(captured []byte, total int64) {
+			if len(encoding) != 0 && !strings.EqualFold(encoding, "identity") {
+				logger.Debugf("%s: %d bytes, %s encoded", description, total, encoding)
+				return
+			}
+			suffix := ""
+			if total > int64(len(captured)) {
+				suffix = ", truncated"
+			}
+			logger.Debugf("%s: %d bytes%s: %q", description, total, suffix, redactor.redact(captured))
+		},
+	}
+}
+
+// formatHeaders returns the headers as sorted name: value pairs for logs, with sensitive values redacted
+func formatHeaders(header http.Header) string {
+	redacted := logRedactor.Header(header)
+	names := slices.Sorted(maps.Keys(redacted))
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, name+": "+strings.Join(redacted[name], ", "))
+	}
+	return strings.Join(pairs, "; ")
+}
+
+// logBodies logs the request headers and body of the route as it is forwarded
+func logBodies(route RedirectConfig, redactor *bodyRedactor) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isVerbose(r) {
+				logger.Debugf("Request headers of %s %s: %s", r.Method, logRedactor.URL(r.URL), formatHeaders(r.Header))
+				description := "Request body of " + r.Method + " " + logRedactor.URL(r.URL)
+				r.Body = route.LogBodies.wrap(r.Body, r.Header, redactor, description)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
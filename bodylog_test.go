@@ -0,0 +1,26 @@
+package router
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestFormatHeaders(t *testing.T) {
+	defer func(previous *redactor) { logRedactor = previous }(logRedactor)
+	logRedactor = newRedactor(nil, []string{"X-Api-Key", "cookie"})
+
+	header := http.Header{}
+	header.Set("X-Api-Key", "secret")
+	header.Add("Cookie", "a=1")
+	header.Add("Accept", "text/html")
+	header.Add("Accept", "application/json")
+	header.Set("Authorization", "Bearer token")
+
+	want := "Accept: text/html, application/json; Authorization: Bearer token; Cookie: ***; X-Api-Key: ***"
+	if got := formatHeaders(header); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if header.Get("X-Api-Key") != "secret" {
+		t.Error("formatting changed the headers")
+	}
+}
@@ -0,0 +1,36 @@
+package router
+
+import "sync"
+
+// defaultProxyBufferSize matches the buffer httputil.ReverseProxy allocates per response without a pool
+const defaultProxyBufferSize = 32 * 1024
+
+// bufferPool recycles the buffers used to copy response bodies to clients, shared by all proxies
+type bufferPool struct {
+	pool sync.Pool
+}
+
+// proxyBufferPool is used by every reverse proxy, sized from the config at startup
+var proxyBufferPool = newBufferPool(defaultProxyBufferSize)
+
+// newBufferPool creates a pool of buffers of the given size, the default size when not positive
+func newBufferPool(size int) *bufferPool {
+	if size <= 0 {
+		size = defaultProxyBufferSize
+	}
+	return &bufferPool{pool: sync.Pool{
+		New: func() any {
+			return make([]byte, size)
+		},
+	}}
+}
+
+// Get returns a buffer from the pool, allocating one when the pool is empty
+func (p *bufferPool) Get() []byte {
+	return p.pool.Get().([]byte)
+}
+
+// Put returns a buffer to the pool once the proxy finished copying
+func (p *bufferPool) Put(buf []byte) {
+	p.pool.Put(buf)
+}
@@ -0,0 +1,241 @@
+package router
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the response cache when not configured
+const (
+	defaultCacheTTL     = time.Minute
+	defaultCacheMaxSize = 16 << 20
+)
+
+// CacheConfig controls in-memory caching of GET responses of a route
+type CacheConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	TTL     time.Duration `mapstructure:"ttl"`      // Lifetime of cached responses, defaults to 1m
+	MaxSize int64         `mapstructure:"max_size"` // Total bytes of cached bodies, defaults to 16MiB
+
+	// Cacheable response statuses and the lifetime of their responses, only 200 for ttl when empty
+	Statuses map[int]time.Duration `mapstructure:"statuses"`
+}
+
+// validate checks the cacheable statuses and their lifetimes
+func (c CacheConfig) validate() error {
+	for status, ttl := range c.Statuses {
+		if status < 200 || status > 599 {
+			return fmt.Errorf("invalid cache status %d: statuses must be between 200 and 599", status)
+		}
+		if ttl <= 0 {
+			return fmt.Errorf("invalid cache ttl %s of status %d: must be positive", ttl, status)
+		}
+	}
+	return nil
+}
+
+type cacheEntry struct {
+	key     string
+	status  int
+	header  http.Header
+	body    []byte
+	ttl     time.Duration
+	expires time.Time
+}
+
+// responseCache is a size-bounded LRU cache of responses
+type responseCache struct {
+	mu       sync.Mutex
+	statuses map[int]time.Duration // Lifetime of the responses of each cacheable status
+	maxSize  int64
+	size     int64
+	entries  map[string]*list.Element
+	lru      *list.List
+}
+
+// newResponseCache creates a cache for the config, returning nil when caching is disabled
+func newResponseCache(cfg CacheConfig) *responseCache {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	c := &responseCache{
+		statuses: cfg.Statuses,
+		maxSize:  cfg.MaxSize,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+	if len(c.statuses) == 0 {
+		ttl := cfg.TTL
+		if ttl <= 0 {
+			ttl = defaultCacheTTL
+		}
+		c.statuses = map[int]time.Duration{http.StatusOK: ttl}
+	}
+	if c.maxSize <= 0 {
+		c.maxSize = defaultCacheMaxSize
+	}
+	return c
+}
+
+// cacheKey returns the key of the request, or false when the request must not be served from cache
+func cacheKey(r *http.Request) (string, bool) {
+	if r.Method != http.MethodGet {
+		return "", false
+	}
+	if len(r.Header.Get("Authorization")) != 0 || hasCacheDirective(r.Header, "no-store") {
+		return "", false
+	}
+	// Backends may encode the body depending on what the client accepts
+	return r.Method + " " + r.URL.RequestURI() + " " + r.Header.Get("Accept-Encoding"), true
+}
+
+// hasCacheDirective reports whether the Cache-Control header contains the directive
+func hasCacheDirective(header http.Header, directive string) bool {
+	for _, value := range header.Values("Cache-Control") {
+		for _, d := range strings.Split(value, ",") {
+			name, _, _ := strings.Cut(strings.TrimSpace(d), "=")
+			if strings.EqualFold(name, directive) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// variesByKey reports whether the response only varies by request headers that are part of the cache key, so
+// responses varying by e.g. Cookie or Accept-Language are not served to other clients
+func variesByKey(header http.Header) bool {
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); len(name) != 0 && !strings.EqualFold(name, "Accept-Encoding") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// get returns the live entry stored for the key
+func (c *responseCache) get(key string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(element)
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return entry, true
+}
+
+// set stores the entry, evicting the least recently used entries until it fits
+func (c *responseCache) set(entry *cacheEntry) {
+	size := int64(len(entry.body))
+	if size > c.maxSize {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[entry.key]; ok {
+		c.remove(element)
+	}
+	for c.size+size > c.maxSize {
+		c.remove(c.lru.Back())
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	c.size += size
+}
+
+// remove deletes the element, the caller must hold the lock
+func (c *responseCache) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= int64(len(entry.body))
+}
+
+// serve writes the cached response to the client
+func (e *cacheEntry) serve(w http.ResponseWriter) {
+	for name, values := range e.header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	w.Header().Set("X-Cache", "HIT")
+	w.WriteHeader(e.status)
+	_, _ = w.Write(e.body)
+}
+
+// capture arranges for the response body to be stored under the key once it has been fully read, returning the
+// lifetime of the stored response, or zero when it is not cacheable. Bodies larger than maxBuffer are streamed
+// without being stored.
+func (c *responseCache) capture(resp *http.Response, key string, maxBuffer int64) time.Duration {
+	limit := min(c.maxSize, maxBuffer)
+
+	resp.Header.Set("X-Cache", "MISS")
+	ttl, ok := c.statuses[resp.StatusCode]
+	if !ok || len(resp.Header.Values("Set-Cookie")) != 0 || !variesByKey(resp.Header) {
+		return 0
+	}
+	if hasCacheDirective(resp.Header, "no-store") || hasCacheDirective(resp.Header, "private") {
+		return 0
+	}
+	if resp.ContentLength > limit {
+		return 0
+	}
+
+	header := resp.Header.Clone()
+	header.Del("X-Cache")
+	resp.Body = &cachingBody{
+		ReadCloser: resp.Body,
+		limit:      limit,
+		done: func(body []byte) {
+			c.set(&cacheEntry{
+				key:     key,
+				status:  resp.StatusCode,
+				header:  header,
+				body:    body,
+				ttl:     ttl,
+				expires: time.Now().Add(ttl),
+			})
+		},
+	}
+	return ttl
+}
+
+// cachingBody copies the body while it is read and hands it over once the end is reached
+type cachingBody struct {
+	io.ReadCloser
+	buf      bytes.Buffer
+	limit    int64
+	overflow bool
+	done     func(body []byte)
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if !b.overflow {
+		if int64(b.buf.Len()+n) > b.limit {
+			b.overflow = true
+			b.buf = bytes.Buffer{}
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF && !b.overflow && b.done != nil {
+		b.done(b.buf.Bytes())
+		b.done = nil
+	}
+	return n, err
+}
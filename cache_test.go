@@ -0,0 +1,38 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCacheVary(t *testing.T) {
+	tests := []struct {
+		vary   []string
+		stored bool
+	}{
+		{nil, true},
+		{[]string{"Accept-Encoding"}, true},
+		{[]string{"accept-encoding, Accept-Encoding"}, true},
+		{[]string{"*"}, false},
+		{[]string{"Cookie"}, false},
+		{[]string{"Accept-Encoding, Accept-Language"}, false},
+		{[]string{"Accept-Encoding", "Origin"}, false},
+	}
+	for _, tt := range tests {
+		cache := newResponseCache(CacheConfig{Enabled: true})
+		resp := &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{"Vary": tt.vary},
+			Body:          io.NopCloser(strings.NewReader("page")),
+			ContentLength: 4,
+		}
+		cache.capture(resp, "GET /", 1<<20)
+		_, _ = io.ReadAll(resp.Body)
+
+		if _, stored := cache.get("GET /"); stored != tt.stored {
+			t.Errorf("Vary %q: stored %v, want %v", tt.vary, stored, tt.stored)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package router
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"strings"
+)
+
+// CanaryConfig splits a percentage of a route's traffic to separate canary backends
+type CanaryConfig struct {
+	Percent float64        `mapstructure:"percent"` // Share of requests sent to the canary targets, 0-100
+	Targets []TargetConfig `mapstructure:"targets"` // Canary backends
+	Header  string         `mapstructure:"header"`  // Request header that pins a request to the canary ("true") or stable ("false") targets
+	Cookie  string         `mapstructure:"cookie"`  // Cookie that pins a request like the header
+}
+
+// enabled reports whether the route has canary targets
+func (c CanaryConfig) enabled() bool {
+	return len(c.Targets) != 0
+}
+
+// selects reports whether the request should be served by the canary targets
+func (c CanaryConfig) selects(r *http.Request) bool {
+	if pinned, ok := c.pinned(r); ok {
+		return pinned
+	}
+	return rand.Float64()*100 < c.Percent
+}
+
+// pinned returns the target group requested through the override header or cookie
+func (c CanaryConfig) pinned(r *http.Request) (canary bool, ok bool) {
+	value := ""
+	if len(c.Header) != 0 {
+		value = r.Header.Get(c.Header)
+	}
+	if len(value) == 0 && len(c.Cookie) != 0 {
+		if cookie, err := r.Cookie(c.Cookie); err == nil {
+			value = cookie.Value
+		}
+	}
+
+	switch strings.ToLower(value) {
+	case "true", "1", "always":
+		return true, true
+	case "false", "0", "never":
+		return false, true
+	}
+	return false, false
+}
@@ -0,0 +1,45 @@
+package router
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Timeout of each backend dial performed by the startup check
+const backendCheckTimeout = 2 * time.Second
+
+// checkBackends dials every target of the enabled routes concurrently, logs a warning for each unreachable one
+// and returns how many were unreachable
+func checkBackends(servers []ServerConfig) int {
+	var wg sync.WaitGroup
+	var unreachable atomic.Int64
+	for _, server := range servers {
+		if !server.IsEnabled() {
+			continue
+		}
+		for _, route := range server.Redirect {
+			if !route.IsEnabled() || len(route.StaticDir) != 0 {
+				continue
+			}
+			for _, target := range route.targetList() {
+				wg.Add(1)
+				go func(port int, name string, target TargetConfig) {
+					defer wg.Done()
+
+					conn, err := net.DialTimeout("tcp", target.String(), backendCheckTimeout)
+					if err != nil {
+						logger.Warnf("Backend %s of route %s on port %d is unreachable: %v",
+							target, name, port, err)
+						unreachable.Add(1)
+						return
+					}
+					_ = conn.Close()
+				}(server.Server, route.label(), target)
+			}
+		}
+	}
+	wg.Wait()
+	return int(unreachable.Load())
+}
@@ -0,0 +1,42 @@
+package router
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+)
+
+// Headers describing the client TLS certificate to backends
+var clientCertHeaderNames = []string{
+	"X-SSL-Client-Verify",
+	"X-Client-Cert-Subject",
+	"X-Client-Cert-Issuer",
+	"X-Client-Cert-Serial",
+	"X-Client-Cert-Fingerprint",
+}
+
+// setClientCertHeaders describes the TLS client certificate of the incoming request in the outgoing headers.
+// Values sent by the client are always removed so backends can trust the headers.
+func setClientCertHeaders(out http.Header, r *http.Request) {
+	for _, name := range clientCertHeaderNames {
+		out.Del(name)
+	}
+
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		out.Set("X-SSL-Client-Verify", "NONE")
+		return
+	}
+
+	cert := r.TLS.PeerCertificates[0]
+	verify := "FAILED"
+	if len(r.TLS.VerifiedChains) != 0 {
+		verify = "SUCCESS"
+	}
+	fingerprint := sha256.Sum256(cert.Raw)
+
+	out.Set("X-SSL-Client-Verify", verify)
+	out.Set("X-Client-Cert-Subject", cert.Subject.String())
+	out.Set("X-Client-Cert-Issuer", cert.Issuer.String())
+	out.Set("X-Client-Cert-Serial", cert.SerialNumber.Text(16))
+	out.Set("X-Client-Cert-Fingerprint", hex.EncodeToString(fingerprint[:]))
+}
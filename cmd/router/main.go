@@ -0,0 +1,8 @@
+// Command router forwards HTTP and WebSocket requests to the backends of its configured routes
+package main
+
+import "github.com/yanun0323/router"
+
+func main() {
+	router.Main()
+}
@@ -0,0 +1,165 @@
+package router
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+)
+
+// coalescedResponse is the response of a coalesced upstream fetch shared with the waiting requests
+type coalescedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+func (c *coalescedResponse) serve(w http.ResponseWriter) {
+	for name, values := range c.header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	w.WriteHeader(c.status)
+	_, _ = w.Write(c.body)
+}
+
+// flight is an upstream fetch in progress, resp is nil when its response could not be shared
+type flight struct {
+	done chan struct{}
+	resp *coalescedResponse
+}
+
+// flightGroup tracks the upstream fetches in progress of a route by request key
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// join returns the fetch in progress for the key, or registers a new one the caller has to complete
+func (g *flightGroup) join(key string) (*flight, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if f, ok := g.flights[key]; ok {
+		return f, false
+	}
+	f := &flight{done: make(chan struct{})}
+	g.flights[key] = f
+	return f, true
+}
+
+// complete publishes the response of the fetch to its waiters
+func (g *flightGroup) complete(key string, f *flight, resp *coalescedResponse) {
+	g.mu.Lock()
+	delete(g.flights, key)
+	g.mu.Unlock()
+
+	f.resp = resp
+	close(f.done)
+}
+
+// coalesce lets concurrent identical GET requests share a single upstream fetch: the first request is
+// forwarded and its response fanned out to the requests that arrived while it was in flight. Requests
+// carrying credentials are forwarded individually. Responses above the buffer limit are streamed to the
+// first request, and like private responses are fetched by the waiters on their own.
+func coalesce(route RedirectConfig) middleware {
+	group := &flightGroup{flights: make(map[string]*flight)}
+	limit := route.bufferLimit()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := cacheKey(r)
+			if !ok || len(r.Header.Get("Cookie")) != 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			f, leader := group.join(key)
+			if !leader {
+				select {
+				case <-f.done:
+				case <-r.Context().Done():
+					return
+				}
+				if f.resp == nil {
+					next.ServeHTTP(w, r)
+					return
+				}
+				if isVerbose(r) {
+					logger.Debugf("Coalesced request: %s", logRedactor.URL(r.URL))
+				}
+				f.resp.serve(w)
+				return
+			}
+
+			// The waiters fetch on their own when the handler panics
+			recorder := &coalesceWriter{ResponseWriter: w, limit: limit}
+			var resp *coalescedResponse
+			defer func() { group.complete(key, f, resp) }()
+
+			next.ServeHTTP(recorder, r)
+			if recorder.passthrough {
+				return
+			}
+			// Nothing is written when the client went away, the waiters fetch on their own then
+			if recorder.status == 0 {
+				return
+			}
+			w.WriteHeader(recorder.status)
+			_, _ = w.Write(recorder.body.Bytes())
+			if r.Context().Err() != nil {
+				return
+			}
+
+			// Responses meant for a single client are not shared
+			header := w.Header()
+			if len(header.Values("Set-Cookie")) == 0 && !hasCacheDirective(header, "private") && !hasCacheDirective(header, "no-store") {
+				resp = &coalescedResponse{status: recorder.status, header: header.Clone(), body: recorder.body.Bytes()}
+			}
+		})
+	}
+}
+
+// coalesceWriter buffers the response of a coalesced fetch, switching to streaming it to the client once
+// the body exceeds the limit
+type coalesceWriter struct {
+	http.ResponseWriter
+	limit       int64
+	status      int
+	body        bytes.Buffer
+	passthrough bool
+}
+
+func (c *coalesceWriter) WriteHeader(status int) {
+	if c.passthrough {
+		c.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if c.status == 0 {
+		c.status = status
+	}
+}
+
+func (c *coalesceWriter) Write(p []byte) (int, error) {
+	if c.passthrough {
+		return c.ResponseWriter.Write(p)
+	}
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	if int64(c.body.Len()+len(p)) <= c.limit {
+		return c.body.Write(p)
+	}
+
+	c.passthrough = true
+	c.ResponseWriter.WriteHeader(c.status)
+	if _, err := c.ResponseWriter.Write(c.body.Bytes()); err != nil {
+		return 0, err
+	}
+	c.body = bytes.Buffer{}
+	return c.ResponseWriter.Write(p)
+}
+
+// Flush forwards flushes of streamed responses, buffered ones are written once complete
+func (c *coalesceWriter) Flush() {
+	if c.passthrough {
+		_ = http.NewResponseController(c.ResponseWriter).Flush()
+	}
+}
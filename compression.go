@@ -0,0 +1,255 @@
+package router
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Content types compressed when no allowlist is configured
+var defaultCompressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+}
+
+// CompressionConfig controls gzip compression of proxied responses
+type CompressionConfig struct {
+	Enabled      bool     `mapstructure:"enabled"`
+	MinSize      int64    `mapstructure:"min_size"`      // Responses with a smaller known length are sent as is
+	ContentTypes []string `mapstructure:"content_types"` // Allowed content types, entries ending with "/" match a whole type
+}
+
+// allows reports whether responses of the given content type should be compressed
+func (c CompressionConfig) allows(contentType string) bool {
+	allowed := c.ContentTypes
+	if len(allowed) == 0 {
+		allowed = defaultCompressibleTypes
+	}
+	return matchesContentType(contentType, allowed)
+}
+
+// matchesContentType reports whether the media type of the Content-Type value is in the list, entries
+// ending with "/" match a whole type
+func matchesContentType(contentType string, allowed []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range allowed {
+		t = strings.ToLower(t)
+		if mediaType == t || (strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsGzip reports whether the client accepts gzip encoded responses
+func acceptsGzip(r *http.Request) bool {
+	return acceptsEncoding(r, "gzip")
+}
+
+// acceptsEncoding reports whether the client accepts responses with the content encoding
+func acceptsEncoding(r *http.Request, want string) bool {
+	for _, value := range r.Header.Values("Accept-Encoding") {
+		for _, encoding := range strings.Split(value, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+			if strings.EqualFold(strings.TrimSpace(name), want) && strings.ReplaceAll(params, " ", "") != "q=0" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decompressResponse decodes gzip and deflate encoded responses the client did not ask to be encoded, so
+// the client and the route's transforms, body logging and caching receive plaintext
+func decompressResponse(resp *http.Response, client *http.Request) {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding != "gzip" && encoding != "deflate" {
+		return
+	}
+	if acceptsEncoding(client, encoding) || client.Method == http.MethodHead {
+		return
+	}
+
+	resp.Body = &decompressedBody{body: resp.Body, encoding: encoding}
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+	resp.Header.Del("Content-Encoding")
+	weakenETag(resp.Header)
+}
+
+// decompressedBody decodes the body on first read, so a malformed body fails the copy to the client
+// instead of the response
+type decompressedBody struct {
+	body     io.ReadCloser
+	encoding string
+	reader   io.Reader
+}
+
+func (d *decompressedBody) Read(p []byte) (int, error) {
+	if d.reader == nil {
+		reader, err := newDecoder(d.encoding, d.body)
+		if err != nil {
+			return 0, err
+		}
+		d.reader = reader
+	}
+	return d.reader.Read(p)
+}
+
+func (d *decompressedBody) Close() error {
+	return d.body.Close()
+}
+
+// newDecoder returns a reader decoding the body. Deflate is zlib wrapped by the standard, but some
+// servers send raw deflate data, which is detected by the missing zlib header.
+func newDecoder(encoding string, body io.Reader) (io.Reader, error) {
+	if encoding == "gzip" {
+		return gzip.NewReader(body)
+	}
+
+	buffered := bufio.NewReader(body)
+	header, err := buffered.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(buffered)
+	}
+	return flate.NewReader(buffered), nil
+}
+
+// Largest decoded request body unless configured otherwise
+const defaultRequestDecompressMaxSize = 10 << 20
+
+// errDecompressedTooLarge is returned for request bodies decoding to more than the limit
+var errDecompressedTooLarge = errors.New("decompressed request body exceeds the size limit")
+
+// DecompressRequestConfig decodes gzip and deflate encoded request bodies for backends that cannot
+type DecompressRequestConfig struct {
+	Enabled bool  `mapstructure:"enabled"`
+	MaxSize int64 `mapstructure:"max_size"` // Largest decoded body in bytes, guarding against zip bombs, defaults to 10MiB
+}
+
+// limit returns the largest decoded body accepted
+func (c DecompressRequestConfig) limit() int64 {
+	if c.MaxSize <= 0 {
+		return defaultRequestDecompressMaxSize
+	}
+	return c.MaxSize
+}
+
+// decompressRequest replaces a gzip or deflate encoded request body with the decoded one, other encodings
+// are left untouched
+func decompressRequest(r *http.Request, limit int64) error {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if (encoding != "gzip" && encoding != "deflate") || r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+
+	reader, err := newDecoder(encoding, r.Body)
+	if err != nil {
+		return err
+	}
+	body, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(body)) > limit {
+		return errDecompressedTooLarge
+	}
+
+	_ = r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Transfer-Encoding")
+	return nil
+}
+
+// gzipBody compresses a response body as it is read. Compressing only starts with the first read, as reading
+// the body to its end fills in the response trailers, which the proxy reads before it copies the body.
+type gzipBody struct {
+	body   io.ReadCloser
+	reader *io.PipeReader
+	once   sync.Once
+}
+
+func newGzipBody(body io.ReadCloser) *gzipBody {
+	return &gzipBody{body: body}
+}
+
+// start compresses the body into the pipe read by Read
+func (g *gzipBody) start() {
+	reader, writer := io.Pipe()
+	g.reader = reader
+	go func() {
+		defer g.body.Close()
+
+		gz := gzip.NewWriter(writer)
+		_, err := io.Copy(gz, g.body)
+		if closeErr := gz.Close(); err == nil {
+			err = closeErr
+		}
+		writer.CloseWithError(err)
+	}()
+}
+
+func (g *gzipBody) Read(p []byte) (int, error) {
+	g.once.Do(g.start)
+	return g.reader.Read(p)
+}
+
+// Close stops compressing, a body never read is closed without being compressed
+func (g *gzipBody) Close() error {
+	started := true
+	g.once.Do(func() { started = false })
+	if !started {
+		return g.body.Close()
+	}
+	return g.reader.Close()
+}
+
+// compressResponse gzips the response body when the client accepts it and the response qualifies,
+// responses known to be larger than maxBuffer are streamed as is
+func compressResponse(resp *http.Response, client *http.Request, cfg CompressionConfig, maxBuffer int64) {
+	if !cfg.Enabled || !acceptsGzip(client) || client.Method == http.MethodHead {
+		return
+	}
+	if resp.Header.Get("Content-Encoding") != "" || resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified {
+		return
+	}
+	if resp.ContentLength >= 0 && (resp.ContentLength < cfg.MinSize || resp.ContentLength > maxBuffer) {
+		return
+	}
+	if !cfg.allows(resp.Header.Get("Content-Type")) || hasCacheDirective(resp.Header, "no-transform") {
+		return
+	}
+
+	resp.Body = newGzipBody(resp.Body)
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+	resp.Header.Set("Content-Encoding", "gzip")
+	resp.Header.Add("Vary", "Accept-Encoding")
+	weakenETag(resp.Header)
+}
+
+// weakenETag marks a strong ETag weak, as the body was re-encoded into a representation the backend did not tag
+func weakenETag(header http.Header) {
+	if etag := header.Get("ETag"); len(etag) != 0 && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+}
@@ -0,0 +1,58 @@
+package router
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     http.Header
+		compressed bool
+		etag       string
+	}{
+		{"strong etag", http.Header{"Etag": {`"v1"`}}, true, `W/"v1"`},
+		{"weak etag", http.Header{"Etag": {`W/"v1"`}}, true, `W/"v1"`},
+		{"no transform", http.Header{"Etag": {`"v1"`}, "Cache-Control": {"public, no-transform"}}, false, `"v1"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.header.Set("Content-Type", "text/plain")
+			resp := &http.Response{
+				StatusCode:    http.StatusOK,
+				Header:        tt.header,
+				Body:          io.NopCloser(strings.NewReader("hello")),
+				ContentLength: 5,
+			}
+			client := httptest.NewRequest(http.MethodGet, "/", nil)
+			client.Header.Set("Accept-Encoding", "gzip")
+
+			compressResponse(resp, client, CompressionConfig{Enabled: true}, 1<<20)
+			defer resp.Body.Close()
+
+			if compressed := resp.Header.Get("Content-Encoding") == "gzip"; compressed != tt.compressed {
+				t.Fatalf("compressed %v, want %v", compressed, tt.compressed)
+			}
+			if etag := resp.Header.Get("ETag"); etag != tt.etag {
+				t.Errorf("got ETag %s, want %s", etag, tt.etag)
+			}
+
+			body := resp.Body
+			if tt.compressed {
+				gz, err := gzip.NewReader(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = gz
+			}
+			if data, err := io.ReadAll(body); err != nil || string(data) != "hello" {
+				t.Errorf("read %q, %v, want %q", data, err, "hello")
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Timeout of fetching the config from a URL
+const configFetchTimeout = 10 * time.Second
+
+// configSource tells where the config is loaded from, ./config.yaml is used when nothing is set
+type configSource struct {
+	File    string // YAML config file
+	Dir     string // Directory whose YAML files are merged
+	URL     string // HTTP(S) URL serving the YAML config
+	URLAuth string // Authorization header value sent when fetching the URL
+	Env     string // Environment variable holding the YAML config
+	Profile string // Top-level block of the config applied on top of the shared settings
+}
+
+// register adds the command line flags selecting the config source
+func (s *configSource) register(flags *flag.FlagSet) {
+	flags.StringVar(&s.File, "config", "", "YAML config file, defaults to ./config.yaml")
+	flags.StringVar(&s.Dir, "config-dir", "", "Directory of YAML config files merged into one config, instead of ./config.yaml")
+	flags.StringVar(&s.URL, "config-url", "", "HTTP(S) URL the YAML config is fetched from, instead of ./config.yaml")
+	flags.StringVar(&s.URLAuth, "config-url-auth", os.Getenv("ROUTER_CONFIG_URL_AUTH"), "Authorization header value sent when fetching --config-url")
+	flags.StringVar(&s.Env, "config-env", "", "Environment variable holding the YAML config, instead of ./config.yaml")
+	flags.StringVar(&s.Profile, "env", os.Getenv("ROUTER_ENV"), "Config profile to apply, e.g. prod, selecting the top-level block of that name")
+}
+
+// loadConfig reads the config from the source
+func loadConfig(source configSource) (Config, error) {
+	var config Config
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+	switch {
+	case len(source.URL) != 0:
+		body, err := fetchConfig(source.URL, source.URLAuth)
+		if err != nil {
+			return config, err
+		}
+		if err := v.ReadConfig(bytes.NewReader(body)); err != nil {
+			return config, fmt.Errorf("read config from %s: %w", source.URL, err)
+		}
+	case len(source.Env) != 0:
+		body, ok := os.LookupEnv(source.Env)
+		if !ok {
+			return config, fmt.Errorf("environment variable %s is not set", source.Env)
+		}
+		if err := v.ReadConfig(strings.NewReader(body)); err != nil {
+			return config, fmt.Errorf("read config from environment variable %s: %w", source.Env, err)
+		}
+	case len(source.Dir) != 0:
+		settings, err := readConfigDir(source.Dir)
+		if err != nil {
+			return config, err
+		}
+		if err := v.MergeConfigMap(settings); err != nil {
+			return config, fmt.Errorf("merge config files: %w", err)
+		}
+	case len(source.File) != 0:
+		v.SetConfigFile(source.File)
+
+		if err := v.ReadInConfig(); err != nil {
+			return config, fmt.Errorf("read config file: %w", err)
+		}
+	default:
+		v.SetConfigName("config")
+		v.AddConfigPath(".")
+
+		if err := v.ReadInConfig(); err != nil {
+			return config, fmt.Errorf("read config file: %w", err)
+		}
+	}
+
+	if len(source.Profile) != 0 {
+		if err := applyProfile(v, source.Profile); err != nil {
+			return config, err
+		}
+	}
+
+	if err := v.Unmarshal(&config); err != nil {
+		return config, fmt.Errorf("parse config file: %w", err)
+	}
+	return config, nil
+}
+
+// applyProfile merges the named top-level block over the rest of the config. Settings of the profile
+// replace the shared ones, lists such as router are replaced as a whole.
+func applyProfile(v *viper.Viper, profile string) error {
+	settings, ok := v.Get(profile).(map[string]any)
+	if !ok {
+		return fmt.Errorf("config profile %q not found", profile)
+	}
+	if err := v.MergeConfigMap(settings); err != nil {
+		return fmt.Errorf("apply config profile %q: %w", profile, err)
+	}
+	return nil
+}
+
+// fetchConfig downloads the config body from the URL
+func fetchConfig(configURL, auth string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), configFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, configURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create config request: %w", err)
+	}
+	if len(auth) != 0 {
+		req.Header.Set("Authorization", auth)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch config from %s: %w", configURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch config from %s: unexpected status %s", configURL, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read config from %s: %w", configURL, err)
+	}
+	return body, nil
+}
+
+// readConfigDir reads all YAML files of the directory in name order and deep-merges their settings
+func readConfigDir(dir string) (map[string]any, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("list config files: %w", err)
+	}
+	ymlFiles, err := filepath.Glob(filepath.Join(dir, "*.yml"))
+	if err != nil {
+		return nil, fmt.Errorf("list config files: %w", err)
+	}
+	files = append(files, ymlFiles...)
+	sort.Strings(files)
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no config files found in %s", dir)
+	}
+
+	settings := make(map[string]any)
+	for _, file := range files {
+		v := viper.New()
+		v.SetConfigFile(file)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("read config file %s: %w", file, err)
+		}
+		deepMerge(settings, v.AllSettings())
+	}
+	return settings, nil
+}
+
+// deepMerge merges src into dst: maps are merged recursively, lists are concatenated and other values of src win
+func deepMerge(dst, src map[string]any) {
+	for key, value := range src {
+		switch srcValue := value.(type) {
+		case map[string]any:
+			if dstValue, ok := dst[key].(map[string]any); ok {
+				deepMerge(dstValue, srcValue)
+				continue
+			}
+		case []any:
+			if dstValue, ok := dst[key].([]any); ok {
+				dst[key] = append(dstValue, srcValue...)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
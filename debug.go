@@ -0,0 +1,89 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Path of the debug endpoint listing the routes loaded by a server
+const debugRoutesPath = "/__routes"
+
+type debugRoute struct {
+	Name        string   `json:"name,omitempty"`
+	Path        string   `json:"path"`
+	Match       string   `json:"match"`
+	Strategy    string   `json:"strategy"`
+	Protocol    string   `json:"protocol"`
+	Targets     []string `json:"targets"`
+	Maintenance bool     `json:"maintenance"`
+
+	// Passive health of each target, failed targets are avoided until their fail timeout passed
+	Health []debugTarget `json:"health"`
+}
+
+type debugTarget struct {
+	Target    string     `json:"target"`
+	Healthy   bool       `json:"healthy"`
+	DownUntil *time.Time `json:"down_until,omitempty"`
+}
+
+type debugServer struct {
+	Server int          `json:"server"`
+	Routes []debugRoute `json:"routes"`
+}
+
+// routesHandler serves the effective routing table of the server as JSON, built from its current config so
+// reloaded routes show up
+func routesHandler(current *liveServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		table := newRoutingTable(*current.Load())
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(table)
+	}
+}
+
+// newRoutingTable describes the routes of the server in match order
+func newRoutingTable(server ServerConfig) debugServer {
+	table := debugServer{
+		Server: server.Server,
+		Routes: make([]debugRoute, 0, len(server.Redirect)),
+	}
+	for _, route := range server.Redirect {
+		targets := make([]string, 0, len(route.balancer.targets))
+		health := make([]debugTarget, 0, len(route.balancer.targets))
+		for _, target := range route.balancer.targets {
+			targets = append(targets, target.String())
+
+			status := debugTarget{Target: target.String(), Healthy: true}
+			if until, down := route.balancer.downTime(target); down {
+				status.Healthy = false
+				status.DownUntil = &until
+			}
+			health = append(health, status)
+		}
+
+		strategy := route.Strategy
+		if len(strategy) == 0 {
+			strategy = StrategyRoundRobin
+		}
+		protocol := route.Protocol
+		if len(protocol) == 0 {
+			protocol = ProtocolHTTP
+		}
+
+		table.Routes = append(table.Routes, debugRoute{
+			Name:        route.Name,
+			Path:        route.Path,
+			Match:       "prefix",
+			Strategy:    strategy,
+			Protocol:    protocol,
+			Targets:     targets,
+			Maintenance: route.Maintenance.Enabled,
+			Health:      health,
+		})
+	}
+	return table
+}
@@ -0,0 +1,83 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// prepareServer returns the prepared server on port 8080 of the config
+func prepareServer(t testing.TB, config Config) *ServerConfig {
+	t.Helper()
+
+	servers, err := prepareServers(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range servers {
+		if servers[i].Server == 8080 {
+			return &servers[i]
+		}
+	}
+	t.Fatal("no server on port 8080")
+	return nil
+}
+
+func TestRoutesHandlerReload(t *testing.T) {
+	serverWithRoute := func(path string) *ServerConfig {
+		return prepareServer(t, Config{Router: []ServerConfig{{
+			Server:   8080,
+			Redirect: []RedirectConfig{{Path: path, Host: "127.0.0.1", Port: 9000}},
+		}}})
+	}
+	current := &liveServer{}
+	current.Store(serverWithRoute("/old"))
+	handler := routesHandler(current)
+
+	paths := func() []string {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, debugRoutesPath, nil))
+		var table debugServer
+		if err := json.NewDecoder(rec.Body).Decode(&table); err != nil {
+			t.Fatal(err)
+		}
+		var paths []string
+		for _, route := range table.Routes {
+			paths = append(paths, route.Path)
+		}
+		return paths
+	}
+
+	if got := paths(); len(got) != 1 || got[0] != "/old" {
+		t.Fatalf("got routes %v, want [/old]", got)
+	}
+	current.Store(serverWithRoute("/new"))
+	if got := paths(); len(got) != 1 || got[0] != "/new" {
+		t.Errorf("got routes %v after reload, want [/new]", got)
+	}
+}
+
+func TestRoutingTableHealth(t *testing.T) {
+	server := prepareServer(t, Config{Router: []ServerConfig{{
+		Server: 8080,
+		Redirect: []RedirectConfig{{
+			Path:    "/",
+			Targets: []TargetConfig{{Host: "127.0.0.1", Port: 9000}, {Host: "127.0.0.1", Port: 9001}},
+		}},
+	}}})
+	route := server.Redirect[0]
+	route.balancer.markFailed(route.balancer.targets[1])
+
+	health := newRoutingTable(*server).Routes[0].Health
+	if len(health) != 2 {
+		t.Fatalf("got %d targets, want 2", len(health))
+	}
+	if !health[0].Healthy || health[0].DownUntil != nil {
+		t.Errorf("got %+v, want %s healthy", health[0], health[0].Target)
+	}
+	if health[1].Healthy || health[1].DownUntil == nil || !health[1].DownUntil.After(time.Now()) {
+		t.Errorf("got %+v, want %s down until a future time", health[1], health[1].Target)
+	}
+}
@@ -0,0 +1,92 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// dnsCache resolves backend host names for the route's connections, reusing each resolution for the TTL so
+// connections pick up address changes once it expired
+type dnsCache struct {
+	ttl      time.Duration
+	resolver *net.Resolver
+	dialer   net.Dialer
+
+	mu      sync.Mutex
+	entries map[string]dnsEntry
+}
+
+// dnsEntry is a cached resolution of a host name
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// newDNSCache returns a cache keeping resolutions for the TTL, or nil when caching is disabled
+func newDNSCache(ttl time.Duration) *dnsCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &dnsCache{
+		ttl:      ttl,
+		resolver: net.DefaultResolver,
+		// Same limits as the dialer of http.DefaultTransport
+		dialer:  net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		entries: make(map[string]dnsEntry),
+	}
+}
+
+// lookup returns the addresses of the host, resolving it again when the cached resolution expired
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := c.resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.entries[host] = dnsEntry{addrs: addrs, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return addrs, nil
+}
+
+// DialContext connects to the address through the cached resolution of its host, trying the addresses in turn
+func (c *dnsCache) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil {
+		return c.dialer.DialContext(ctx, network, address)
+	}
+
+	addrs, err := c.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for _, addr := range addrs {
+		conn, err := c.dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// dialContext returns the dial function of the route's backend connections, nil dials with the defaults
+func (r RedirectConfig) dialContext() func(ctx context.Context, network, address string) (net.Conn, error) {
+	if r.dnsCache == nil {
+		return nil
+	}
+	return r.dnsCache.DialContext
+}
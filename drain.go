@@ -0,0 +1,113 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Interval between draining progress logs during shutdown
+const drainLogInterval = time.Second
+
+// Grace period of requests to a reconfigured route after a reload unless configured otherwise
+const defaultRouteDrainTimeout = 30 * time.Second
+
+// Interval between checks of the requests remaining on a retired route
+const routeDrainPollInterval = 100 * time.Millisecond
+
+// runningServer is a started server along with its count of requests in flight
+type runningServer struct {
+	port   int
+	srv    *http.Server
+	active *atomic.Int64
+}
+
+// trackActive counts the requests currently served by the handler
+func trackActive(handler http.Handler, active *atomic.Int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		active.Add(1)
+		defer active.Add(-1)
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// logDraining logs the number of requests remaining on each server periodically until done is closed
+func logDraining(servers []*runningServer, done <-chan struct{}) {
+	ticker := time.NewTicker(drainLogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			for _, server := range servers {
+				if remaining := server.active.Load(); remaining > 0 {
+					logger.Warnf("Server on port %d draining: %d requests remaining",
+						server.port, remaining)
+				}
+			}
+		}
+	}
+}
+
+// routeDrain tracks the requests of a route so they can finish after the route was replaced by a reload
+type routeDrain struct {
+	active atomic.Int64
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// newRouteDrain creates the request tracking of a route
+func newRouteDrain() *routeDrain {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &routeDrain{ctx: ctx, cancel: cancel}
+}
+
+// cancelled reports whether the remaining requests of the route were cancelled after a reload
+func (d *routeDrain) cancelled() bool {
+	return d.ctx.Err() != nil
+}
+
+// trackRoute counts the requests of the route in flight and cancels them when the retired route stops draining
+func trackRoute(route RedirectConfig) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route.drain.active.Add(1)
+			defer route.drain.active.Add(-1)
+
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+			stop := context.AfterFunc(route.drain.ctx, cancel)
+			defer stop()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// retire waits for the requests in flight on the replaced route, cancelling those of a changed route that are
+// still running after its drain timeout, then closes the idle backend connections of the route's transport
+func (d *routeDrain) retire(route RedirectConfig, changed bool) {
+	timeout := route.DrainTimeout
+	if timeout <= 0 {
+		timeout = defaultRouteDrainTimeout
+	}
+	deadline := time.Now().Add(timeout)
+
+	ticker := time.NewTicker(routeDrainPollInterval)
+	defer ticker.Stop()
+	for d.active.Load() > 0 {
+		if changed && time.Now().After(deadline) {
+			logger.Warnf("Route %s still had %d requests in flight after draining for %s, cancelling them",
+				route.label(), d.active.Load(), timeout)
+			break
+		}
+		<-ticker.C
+	}
+	d.cancel()
+
+	if transport, ok := route.transport.(interface{ CloseIdleConnections() }); ok {
+		transport.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,61 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Upstream proxy value that connects to backends directly, ignoring the proxy environment variables
+const upstreamProxyDirect = "direct"
+
+// parseUpstreamProxy validates the upstream proxy setting, empty values use the proxy environment variables
+func parseUpstreamProxy(raw string) (*url.URL, error) {
+	if len(raw) == 0 || raw == upstreamProxyDirect {
+		return nil, nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream_proxy %q: %w", raw, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid upstream_proxy %q: scheme must be http, https or socks5", raw)
+	}
+	if len(u.Host) == 0 {
+		return nil, fmt.Errorf("invalid upstream_proxy %q: missing host", raw)
+	}
+	return u, nil
+}
+
+// newRouteTransport returns the transport of HTTP/1 routes that need a different one than
+// http.DefaultTransport, or nil when the default suits the route
+func newRouteTransport(route RedirectConfig) http.RoundTripper {
+	if !route.DisableKeepAlives && len(route.UpstreamProxy) == 0 && route.dnsCache == nil {
+		return nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = route.DisableKeepAlives
+	transport.Proxy = route.proxyFunc()
+	if dial := route.dialContext(); dial != nil {
+		transport.DialContext = dial
+	}
+	return transport
+}
+
+// proxyFunc returns the proxy selection of the route's backend connections, also used for WebSocket dials
+func (r RedirectConfig) proxyFunc() func(*http.Request) (*url.URL, error) {
+	switch r.UpstreamProxy {
+	case "":
+		return http.ProxyFromEnvironment
+	case upstreamProxyDirect:
+		return nil
+	default:
+		// Validated by prepareServers
+		proxyURL, _ := parseUpstreamProxy(r.UpstreamProxy)
+		return http.ProxyURL(proxyURL)
+	}
+}
@@ -0,0 +1,61 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ErrorPageConfig describes the response sent to clients when proxying fails
+type ErrorPageConfig struct {
+	Body        string `mapstructure:"body"`         // Defaults to the status text
+	ContentType string `mapstructure:"content_type"` // Defaults to text/plain
+
+	// Responses of single statuses, e.g. 504, replacing body for them and content_type when set
+	Statuses map[int]ErrorPageConfig `mapstructure:"statuses"`
+}
+
+// validate checks that the pages are only configured for error statuses
+func (e ErrorPageConfig) validate() error {
+	for status, page := range e.Statuses {
+		if status < http.StatusBadRequest || status > 599 {
+			return fmt.Errorf("error_page status %d is not an error status", status)
+		}
+		if len(page.Statuses) != 0 {
+			return fmt.Errorf("error_page status %d cannot list statuses", status)
+		}
+	}
+	return nil
+}
+
+// serve writes the error response with the given status, the underlying error is never exposed
+func (e ErrorPageConfig) serve(w http.ResponseWriter, status int) {
+	if page, ok := e.Statuses[status]; ok {
+		if len(page.ContentType) == 0 {
+			page.ContentType = e.ContentType
+		}
+		e = page
+	}
+
+	body := e.Body
+	if len(body) == 0 {
+		body = http.StatusText(status) + "\n"
+	}
+
+	contentType := e.ContentType
+	if len(contentType) == 0 {
+		contentType = "text/plain; charset=utf-8"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(body))
+}
+
+// proxyErrorStatus returns the status reported to the client for a proxy error
+func proxyErrorStatus(err error) int {
+	if isTimeout(err) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
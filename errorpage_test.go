@@ -0,0 +1,49 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorPageStatuses(t *testing.T) {
+	page := ErrorPageConfig{
+		Body:        `{"error":"upstream unavailable"}`,
+		ContentType: "application/json",
+		Statuses: map[int]ErrorPageConfig{
+			http.StatusGatewayTimeout:        {Body: `{"error":"upstream timed out"}`},
+			http.StatusRequestEntityTooLarge: {Body: "too large", ContentType: "text/plain"},
+		},
+	}
+	if err := page.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		status      int
+		body        string
+		contentType string
+	}{
+		{http.StatusBadGateway, `{"error":"upstream unavailable"}`, "application/json"},
+		{http.StatusGatewayTimeout, `{"error":"upstream timed out"}`, "application/json"},
+		{http.StatusRequestEntityTooLarge, "too large", "text/plain"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		page.serve(rec, tt.status)
+		if rec.Code != tt.status || rec.Body.String() != tt.body || rec.Header().Get("Content-Type") != tt.contentType {
+			t.Errorf("status %d: got %d %q (%s), want %q (%s)", tt.status, rec.Code, rec.Body.String(), rec.Header().Get("Content-Type"), tt.body, tt.contentType)
+		}
+	}
+
+	// Without a shared body, statuses without an entry fall back to the status text
+	rec := httptest.NewRecorder()
+	ErrorPageConfig{Statuses: page.Statuses}.serve(rec, http.StatusServiceUnavailable)
+	if rec.Body.String() != "Service Unavailable\n" {
+		t.Errorf("got body %q, want the status text", rec.Body.String())
+	}
+
+	if err := (ErrorPageConfig{Statuses: map[int]ErrorPageConfig{200: {}}}).validate(); err == nil {
+		t.Error("expected a page for a success status to be rejected")
+	}
+}
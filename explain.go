@@ -0,0 +1,171 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// explanation describes how a server would handle a request
+type explanation struct {
+	Server        int      `json:"server"`
+	Matched       bool     `json:"matched"`
+	Route         string   `json:"route,omitempty"`
+	RouteName     string   `json:"route_name,omitempty"`
+	Match         string   `json:"match,omitempty"`
+	MethodAllowed bool     `json:"method_allowed"`
+	Action        string   `json:"action,omitempty"`
+	StaticDir     string   `json:"static_dir,omitempty"`
+	Strategy      string   `json:"strategy,omitempty"`
+	Targets       []string `json:"targets,omitempty"`
+	CanaryTargets []string `json:"canary_targets,omitempty"`
+	CanaryPercent float64  `json:"canary_percent,omitempty"`
+	ForwardedPath string   `json:"forwarded_path,omitempty"`
+	HostHeader    string   `json:"host_header,omitempty"`
+}
+
+// runExplain prints which server and route would handle a request without starting any server
+func runExplain(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("explain", flag.ContinueOnError)
+	var source configSource
+	source.register(flags)
+	method := flags.String("method", "GET", "HTTP method of the request")
+	path := flags.String("path", "", "Path of the request, may include a query")
+	host := flags.String("host", "localhost", "Host header of the request")
+	header := http.Header{}
+	flags.Func("header", "Header of the request as \"Name: value\", may be repeated", func(raw string) error {
+		name, value, ok := strings.Cut(raw, ":")
+		if !ok {
+			return fmt.Errorf("invalid header %q, expected Name: value", raw)
+		}
+		header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		return nil
+	})
+	port := flags.Int("port", 0, "Only explain the server listening on this port")
+	asJSON := flags.Bool("json", false, "Print the result as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if len(*path) == 0 {
+		return errors.New("--path is required")
+	}
+
+	requestURL, err := url.Parse(*path)
+	if err != nil {
+		return fmt.Errorf("parse path: %w", err)
+	}
+
+	config, err := loadConfig(source)
+	if err != nil {
+		return err
+	}
+	config.expandEnv()
+
+	servers, err := prepareServers(config)
+	if err != nil {
+		return err
+	}
+
+	results := make([]explanation, 0, len(servers))
+	for _, server := range servers {
+		if !server.IsEnabled() || (*port != 0 && server.Server != *port) {
+			continue
+		}
+		results = append(results, explain(server, strings.ToUpper(*method), requestURL.Path, *host, header))
+	}
+	if len(results) == 0 {
+		return errors.New("no enabled server matches")
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	}
+	for _, result := range results {
+		printExplanation(out, result, requestURL)
+	}
+	return nil
+}
+
+// explain resolves how the server would handle the request
+func explain(server ServerConfig, method, path, host string, header http.Header) explanation {
+	result := explanation{Server: server.Server}
+	route, ok := server.routes.match(method, path, header)
+	if !ok {
+		return result
+	}
+
+	result.Matched = true
+	result.Route = route.Path
+	result.RouteName = route.Name
+	result.Match = "prefix"
+	result.MethodAllowed = route.allowsMethod(method)
+	switch {
+	case server.Maintenance.Enabled || route.Maintenance.Enabled:
+		result.Action = "maintenance"
+	case route.static != nil:
+		result.Action = "static"
+		result.StaticDir = route.StaticDir
+	default:
+		result.Action = "proxy"
+		result.Strategy = route.Strategy
+		if len(result.Strategy) == 0 {
+			result.Strategy = StrategyRoundRobin
+		}
+		result.Targets = strings.Split(joinTargets(route.balancer.targets), ", ")
+		if route.canary != nil {
+			result.CanaryTargets = strings.Split(joinTargets(route.canary.targets), ", ")
+			result.CanaryPercent = route.Canary.Percent
+		}
+		result.ForwardedPath = rewritePath(path, route)
+		result.HostHeader = host
+		if !boolValue(route.PreserveHost, true) {
+			result.HostHeader = route.balancer.targets[0].String()
+		}
+	}
+	return result
+}
+
+// printExplanation writes the explanation in a human-readable form
+func printExplanation(out io.Writer, result explanation, requestURL *url.URL) {
+	fmt.Fprintf(out, "Server :%d\n", result.Server)
+	if !result.Matched {
+		fmt.Fprintf(out, "  No route matches %s, the request receives 404 Not Found\n\n", requestURL.Path)
+		return
+	}
+
+	fmt.Fprintf(out, "  Route:          %s (%s match)\n", result.Route, result.Match)
+	if len(result.RouteName) != 0 {
+		fmt.Fprintf(out, "  Route name:     %s\n", result.RouteName)
+	}
+	if !result.MethodAllowed {
+		fmt.Fprintf(out, "  Method:         not allowed, the request receives 405 Method Not Allowed\n\n")
+		return
+	}
+
+	switch result.Action {
+	case "maintenance":
+		fmt.Fprintf(out, "  Action:         maintenance response\n")
+	case "static":
+		fmt.Fprintf(out, "  Action:         serve files from %s\n", result.StaticDir)
+	default:
+		forwarded := result.ForwardedPath
+		if len(requestURL.RawQuery) != 0 {
+			forwarded += "?" + requestURL.RawQuery
+		}
+		fmt.Fprintf(out, "  Action:         proxy\n")
+		fmt.Fprintf(out, "  Targets:        %s (%s)\n", strings.Join(result.Targets, ", "), result.Strategy)
+		if len(result.CanaryTargets) != 0 {
+			fmt.Fprintf(out, "  Canary targets: %s (%g%%)\n", strings.Join(result.CanaryTargets, ", "), result.CanaryPercent)
+		}
+		fmt.Fprintf(out, "  Forwarded path: %s\n", forwarded)
+		fmt.Fprintf(out, "  Host header:    %s\n", result.HostHeader)
+	}
+	fmt.Fprintln(out)
+}
@@ -0,0 +1,25 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Backend protocols of a route
+const (
+	ProtocolHTTP = "http"
+	ProtocolGRPC = "grpc"
+)
+
+// isGRPCRequest reports whether the request was sent by a gRPC client
+func isGRPCRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// writeGRPCUnavailable reports a proxy failure to a gRPC client using gRPC status trailers-only response
+func writeGRPCUnavailable(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", "14") // UNAVAILABLE
+	w.Header().Set("Grpc-Message", message)
+	w.WriteHeader(http.StatusOK)
+}
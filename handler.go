@@ -0,0 +1,97 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"sync/atomic"
+)
+
+// NewHandler returns the handler of the server listening on the port in the config, with its routes and
+// middlewares wired as when the router runs, but without binding the port. It serves the config in process,
+// e.g. to drive the router with httptest in benchmarks. Servers with port 0 or a port range only know their
+// port once bound, so they cannot be selected.
+func NewHandler(config Config, port int) (http.Handler, error) {
+	if port <= 0 {
+		return nil, fmt.Errorf("invalid port %d, servers with port 0 or a port range cannot be selected", port)
+	}
+	config.expandEnv()
+	servers, err := prepareServers(config)
+	if err != nil {
+		return nil, err
+	}
+	trustedProxies, err := parseTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, server := range servers {
+		if server.Server == port && server.IsEnabled() {
+			current := &liveServer{}
+			current.Store(&server)
+			// Handlers served in process do not warm up
+			ready := &atomic.Bool{}
+			ready.Store(true)
+			return newServerHandler(current, trustedProxies, &atomic.Int64{}, ready, context.Background()), nil
+		}
+	}
+	return nil, fmt.Errorf("no enabled server on port %d", port)
+}
+
+// newServerHandler builds the handler of a server serving the routes of its current config, counting the
+// requests in flight in active and reporting ready on /healthz. WebSocket bridges are closed once the shutdown
+// context is cancelled.
+func newServerHandler(current *liveServer, trustedProxies []netip.Prefix, active *atomic.Int64, ready *atomic.Bool, shutdown context.Context) http.Handler {
+	serverCfg := *current.Load()
+
+	mux := http.NewServeMux()
+	if serverCfg.DebugRoutes {
+		mux.HandleFunc(debugRoutesPath, routesHandler(current))
+	}
+	if serverCfg.Healthz {
+		mux.HandleFunc(healthzPath, healthzHandler(ready))
+	}
+	if serverCfg.Version {
+		mux.HandleFunc(versionPath, versionHandler)
+	}
+	if serverCfg.Metrics {
+		mux.HandleFunc(metricsPath, metricsHandler)
+	}
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		// Use the latest config, requests in flight keep the config they started with
+		cfg := current.Load()
+
+		// Send plain HTTP clients to the HTTPS server
+		if cfg.RedirectToHTTPS.Enabled {
+			cfg.RedirectToHTTPS.serve(w, r)
+			return
+		}
+
+		// Short-circuit every request while the server is under maintenance
+		if cfg.Maintenance.Enabled {
+			logger.Warnf("Server under maintenance, rejecting request: %s", r.URL.Path)
+			cfg.Maintenance.serve(w)
+			return
+		}
+
+		handleRequest(w, r, cfg.routes, cfg.NotFound, shutdown)
+	})
+
+	var handler http.Handler = mux
+	// gRPC clients require HTTP/2, so h2c is enabled for servers with gRPC routes
+	if serverCfg.H2C || serverCfg.hasGRPCRoutes() {
+		handler = withH2C(handler)
+	}
+	if serverCfg.MaxConcurrentRequests > 0 {
+		handler = limitConcurrency(handler, serverCfg.MaxConcurrentRequests, serverCfg.OverloadRetryAfter)
+	}
+
+	// Resolve the real client IP before any handler uses it
+	if len(trustedProxies) != 0 {
+		handler = resolveClientIP(handler, trustedProxies)
+	}
+
+	// Count requests in flight to report draining progress on shutdown
+	return trackActive(handler, active)
+}
@@ -0,0 +1,93 @@
+package router_test
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/yanun0323/router"
+)
+
+// newBackendConfig returns a config with a single server on port 8080 forwarding every path to the backend
+func newBackendConfig(t testing.TB, backend *httptest.Server) router.Config {
+	t.Helper()
+
+	host, port, err := net.SplitHostPort(backend.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	portNumber, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := false
+	return router.Config{
+		Router: []router.ServerConfig{{
+			Server: 8080,
+			Redirect: []router.RedirectConfig{{
+				Path: "/",
+				Host: host,
+				Port: portNumber,
+				Log:  &log,
+			}},
+		}},
+	}
+}
+
+func TestNewHandler(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "backend "+r.URL.Path)
+	}))
+	defer backend.Close()
+
+	config := newBackendConfig(t, backend)
+	config.Router[0].Redirect[0].TargetPrefix = "${ROUTER_TEST_PREFIX}"
+	t.Setenv("ROUTER_TEST_PREFIX", "/v1")
+
+	handler, err := router.NewHandler(config, 8080)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "backend /v1/users" {
+		t.Errorf("got %d %q, want 200 %q", rec.Code, rec.Body.String(), "backend /v1/users")
+	}
+
+	// The environment is expanded on a copy of the caller's config
+	if prefix := config.Router[0].Redirect[0].TargetPrefix; prefix != "${ROUTER_TEST_PREFIX}" {
+		t.Errorf("caller's config changed to %q", prefix)
+	}
+
+	if _, err := router.NewHandler(config, 9090); err == nil {
+		t.Error("expected an error for a port without a server")
+	}
+	if _, err := router.NewHandler(config, 0); err == nil {
+		t.Error("expected an error for port 0")
+	}
+}
+
+func BenchmarkHandleHTTP(b *testing.B) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+
+	handler, err := router.NewHandler(newBackendConfig(b, backend), 8080)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/bench", nil))
+		if rec.Code != http.StatusOK {
+			b.Fatalf("got status %d", rec.Code)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package router
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Path of the readiness endpoint of servers with healthz enabled
+const healthzPath = "/healthz"
+
+// Delay between warmup probe rounds when not configured
+const defaultWarmupInterval = time.Second
+
+// WarmupConfig delays readiness until the backends are reachable
+type WarmupConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Interval time.Duration `mapstructure:"interval"` // Delay between probe rounds, defaults to 1s
+	Timeout  time.Duration `mapstructure:"timeout"`  // Become ready anyway after this long, waits indefinitely when zero
+}
+
+// healthzHandler answers 200 once ready is set and 503 before
+func healthzHandler(ready *atomic.Bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		if !ready.Load() {
+			http.Error(w, "Not Ready", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("OK\n"))
+	}
+}
+
+// warmup probes the backends until every one is reachable, or the timeout passes, then sets ready
+func warmup(servers []ServerConfig, cfg WarmupConfig, ready *atomic.Bool) {
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultWarmupInterval
+	}
+	start := time.Now()
+	for {
+		if checkBackends(servers) == 0 {
+			logger.Infof("Warmup complete after %s, ready to accept traffic", time.Since(start).Round(time.Millisecond))
+			break
+		}
+		if cfg.Timeout > 0 && time.Since(start) >= cfg.Timeout {
+			logger.Warnf("Warmup timed out after %s with unreachable backends, ready to accept traffic", cfg.Timeout)
+			break
+		}
+		time.Sleep(interval)
+	}
+	ready.Store(true)
+}
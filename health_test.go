@@ -0,0 +1,44 @@
+package router
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadinessPerRun(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	server := prepareServer(t, Config{Router: []ServerConfig{{
+		Server:   8080,
+		Healthz:  true,
+		Redirect: []RedirectConfig{{Path: "/", Host: "127.0.0.1", Port: backend.Listener.Addr().(*net.TCPAddr).Port}},
+	}}})
+	healthz := func(ready *atomic.Bool) int {
+		current := &liveServer{}
+		current.Store(server)
+		rec := httptest.NewRecorder()
+		newServerHandler(current, nil, &atomic.Int64{}, ready, context.Background()).
+			ServeHTTP(rec, httptest.NewRequest(http.MethodGet, healthzPath, nil))
+		return rec.Code
+	}
+
+	warmed, other := &atomic.Bool{}, &atomic.Bool{}
+	if status := healthz(warmed); status != http.StatusServiceUnavailable {
+		t.Fatalf("got %d before warmup, want 503", status)
+	}
+	warmup([]ServerConfig{*server}, WarmupConfig{Enabled: true, Interval: 10 * time.Millisecond}, warmed)
+
+	// Warming up one run leaves the readiness of another untouched
+	if status := healthz(warmed); status != http.StatusOK {
+		t.Errorf("got %d after warmup, want 200", status)
+	}
+	if status := healthz(other); status != http.StatusServiceUnavailable {
+		t.Errorf("got %d for a run that did not warm up, want 503", status)
+	}
+}
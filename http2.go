@@ -0,0 +1,33 @@
+package router
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// withH2C wraps the handler so the listener accepts HTTP/2 over cleartext connections
+func withH2C(handler http.Handler) http.Handler {
+	return h2c.NewHandler(handler, &http2.Server{})
+}
+
+// newH2CTransport creates a transport that speaks HTTP/2 to backends over cleartext connections.
+// httputil.ReverseProxy only uses HTTP/2 upstream when the transport negotiates it, and the default
+// transport only does so through TLS ALPN, so plaintext backends need a dedicated HTTP/2 transport.
+// Connections are opened with dial when set.
+func newH2CTransport(dial func(ctx context.Context, network, addr string) (net.Conn, error)) http.RoundTripper {
+	if dial == nil {
+		var dialer net.Dialer
+		dial = dialer.DialContext
+	}
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return dial(ctx, network, addr)
+		},
+	}
+}
@@ -0,0 +1,49 @@
+package router
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// HTTPSRedirectConfig redirects every request of a plain HTTP server to HTTPS
+type HTTPSRedirectConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	Port    int  `mapstructure:"port"`   // HTTPS port redirected to, defaults to 443
+	Status  int  `mapstructure:"status"` // 301 or 308 (default), 308 keeps the method and body of the request
+}
+
+// validate checks that the redirect status is a permanent redirect
+func (c HTTPSRedirectConfig) validate() error {
+	if c.Status != 0 && c.Status != http.StatusMovedPermanently && c.Status != http.StatusPermanentRedirect {
+		return fmt.Errorf("redirect_to_https status must be 301 or 308, got %d", c.Status)
+	}
+	return nil
+}
+
+// serve redirects the request to the same host, path and query on the HTTPS port
+func (c HTTPSRedirectConfig) serve(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+
+	port := c.Port
+	if port == 0 {
+		port = 443
+	}
+	if port != 443 {
+		host = net.JoinHostPort(host, strconv.Itoa(port))
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	status := c.Status
+	if status == 0 {
+		status = http.StatusPermanentRedirect
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+}
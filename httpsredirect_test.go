@@ -0,0 +1,28 @@
+package router
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedirectToHTTPSWithTLS(t *testing.T) {
+	tls := TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem"}
+	redirect := HTTPSRedirectConfig{Enabled: true}
+
+	_, err := prepareServers(Config{Router: []ServerConfig{{Server: 443, TLS: tls, RedirectToHTTPS: redirect}}})
+	if err == nil || !strings.Contains(err.Error(), "redirect_to_https") {
+		t.Errorf("got error %v, want redirect_to_https rejected on a TLS server", err)
+	}
+
+	// A block serving both ports only redirects on the plain HTTP one
+	tls.Ports = []int{443}
+	servers, err := prepareServers(Config{Router: []ServerConfig{{Ports: []int{80, 443}, TLS: tls, RedirectToHTTPS: redirect}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, server := range servers {
+		if redirects := server.Server == 80; server.RedirectToHTTPS.Enabled != redirects || server.TLS.enabled() == redirects {
+			t.Errorf("server on port %d: redirect %t, tls %t", server.Server, server.RedirectToHTTPS.Enabled, server.TLS.enabled())
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package router
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+)
+
+// Lifetime of stored responses to idempotency keys unless configured otherwise
+const defaultIdempotencyTTL = 24 * time.Hour
+
+// IdempotencyConfig deduplicates requests carrying an Idempotency-Key header: the first response to a key is
+// stored and replayed to repeated requests with the same key and path instead of forwarding them again
+type IdempotencyConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	TTL     time.Duration `mapstructure:"ttl"`      // Time a response is replayed for its key, defaults to 24h
+	MaxSize int64         `mapstructure:"max_size"` // Total bytes of stored bodies, defaults to 16MiB
+}
+
+// idempotency replays the stored response to requests repeating an idempotency key. Requests with a key in
+// flight wait for its response. Server errors, timeouts and rate limits are not stored so the client can retry
+// them, and neither are responses larger than the route's buffer limit or those of cancelled requests.
+func idempotency(route RedirectConfig) middleware {
+	cfg := route.Idempotency
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	store := newResponseCache(CacheConfig{Enabled: true, TTL: ttl, MaxSize: cfg.MaxSize})
+	group := &flightGroup{flights: make(map[string]*flight)}
+	limit := min(store.maxSize, route.bufferLimit())
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			value := r.Header.Get("Idempotency-Key")
+			if len(value) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key := r.URL.Path + " " + value
+
+			for {
+				if entry, ok := store.get(key); ok {
+					if isVerbose(r) {
+						logger.Debugf("Replaying response to idempotency key of %s", logRedactor.URL(r.URL))
+					}
+					replayIdempotent(w, entry)
+					return
+				}
+				f, leader := group.join(key)
+				if leader {
+					recorder := &recordingWriter{ResponseWriter: w, limit: limit}
+					defer group.complete(key, f, nil)
+
+					next.ServeHTTP(recorder, r)
+					if storableIdempotent(recorder, r) {
+						store.set(&cacheEntry{
+							key:     key,
+							status:  recorder.status,
+							header:  w.Header().Clone(),
+							body:    recorder.body.Bytes(),
+							ttl:     ttl,
+							expires: time.Now().Add(ttl),
+						})
+					}
+					return
+				}
+
+				// Wait for the request in flight, then replay its response or forward when it was not stored
+				select {
+				case <-f.done:
+				case <-r.Context().Done():
+					return
+				}
+				if _, ok := store.get(key); !ok {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		})
+	}
+}
+
+// storableIdempotent reports whether the recorded response is replayed to repeated keys. Nothing is stored
+// when no response was written or the client went away, e.g. the proxy writes nothing for cancelled requests,
+// and neither are timeouts and rate limits which would otherwise be replayed for the whole TTL.
+func storableIdempotent(recorder *recordingWriter, r *http.Request) bool {
+	if recorder.status == 0 || recorder.overflow || r.Context().Err() != nil {
+		return false
+	}
+	switch recorder.status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return recorder.status < http.StatusInternalServerError
+}
+
+// replayIdempotent writes the stored response, marked as a replay
+func replayIdempotent(w http.ResponseWriter, entry *cacheEntry) {
+	for name, values := range entry.header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(entry.status)
+	_, _ = w.Write(entry.body)
+}
+
+// recordingWriter passes the response through to the client while keeping a copy of its body up to the limit
+type recordingWriter struct {
+	http.ResponseWriter
+	limit    int64
+	status   int
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (rw *recordingWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	if !rw.overflow {
+		if int64(rw.body.Len()+len(p)) > rw.limit {
+			rw.overflow = true
+			rw.body = bytes.Buffer{}
+		} else {
+			rw.body.Write(p)
+		}
+	}
+	return rw.ResponseWriter.Write(p)
+}
+
+// Flush forwards flushes of streamed responses
+func (rw *recordingWriter) Flush() {
+	_ = http.NewResponseController(rw.ResponseWriter).Flush()
+}
@@ -0,0 +1,51 @@
+package router
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// Time the shutdown hooks get to finish together
+const shutdownHookTimeout = 10 * time.Second
+
+// OnShutdown registers a hook run by the graceful shutdown once the servers stopped, e.g. to flush metrics
+// or close database pools. Hooks run in registration order, their context expires after 10 seconds.
+func (rt *Router) OnShutdown(hook func(ctx context.Context)) {
+	rt.hooksMu.Lock()
+	defer rt.hooksMu.Unlock()
+	rt.hooks = append(rt.hooks, hook)
+}
+
+// Done returns a channel closed once the router shut down and its shutdown hooks returned
+func (rt *Router) Done() <-chan struct{} {
+	return rt.done
+}
+
+// Wait blocks until the router shut down and its shutdown hooks returned
+func (rt *Router) Wait() {
+	<-rt.done
+}
+
+// runShutdownHooks calls the registered hooks and reports the router done, a panicking hook does not
+// keep the remaining ones from running
+func (rt *Router) runShutdownHooks() {
+	defer close(rt.done)
+
+	rt.hooksMu.Lock()
+	hooks := slices.Clone(rt.hooks)
+	rt.hooksMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownHookTimeout)
+	defer cancel()
+	for _, hook := range hooks {
+		func() {
+			defer func() {
+				if err := recover(); err != nil {
+					logger.Errorf("Shutdown hook panicked: %v", err)
+				}
+			}()
+			hook(ctx)
+		}()
+	}
+}
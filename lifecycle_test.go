@@ -0,0 +1,66 @@
+package router_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yanun0323/router"
+)
+
+func TestRouterShutdownHooks(t *testing.T) {
+	rt := router.New(router.Config{
+		Router: []router.ServerConfig{{
+			Server:   0,
+			Redirect: []router.RedirectConfig{{Path: "/", Host: "127.0.0.1", Port: 1}},
+		}},
+	})
+
+	var calls []string
+	rt.OnShutdown(func(ctx context.Context) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("expected the hook context to have a deadline")
+		}
+		calls = append(calls, "first")
+	})
+	rt.OnShutdown(func(ctx context.Context) { panic("hook failed") })
+	rt.OnShutdown(func(ctx context.Context) { calls = append(calls, "last") })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() { errs <- rt.Run(ctx) }()
+
+	select {
+	case <-rt.Done():
+		t.Fatal("router done before its context was cancelled")
+	case <-time.After(50 * time.Millisecond):
+	}
+	cancel()
+
+	select {
+	case <-rt.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("router not done after shutdown")
+	}
+	rt.Wait()
+	if err := <-errs; err != nil {
+		t.Fatalf("Run returned %v", err)
+	}
+	if len(calls) != 2 || calls[0] != "first" || calls[1] != "last" {
+		t.Errorf("hooks ran as %v, want [first last]", calls)
+	}
+}
+
+func TestRouterInvalidConfig(t *testing.T) {
+	rt := router.New(router.Config{TrustedProxies: []string{"not an address"}})
+	if err := rt.Run(context.Background()); err == nil {
+		t.Fatal("expected an error for an invalid config")
+	}
+
+	// Waiting on a router that failed to start returns
+	select {
+	case <-rt.Done():
+	default:
+		t.Error("router not done after failing to start")
+	}
+}
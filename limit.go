@@ -0,0 +1,95 @@
+package router
+
+import (
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// limitConcurrency caps the number of requests served simultaneously by the handler, rejecting excess
+// requests with 503 Service Unavailable. WebSocket upgrades are long-lived and therefore not counted.
+func limitConcurrency(handler http.Handler, max int, retryAfter string) http.Handler {
+	slots := make(chan struct{}, max)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if websocket.IsWebSocketUpgrade(r) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+			handler.ServeHTTP(w, r)
+		default:
+			logger.Errorf("Concurrent request limit of %d reached, rejecting request: %s", max, r.URL.Path)
+			if len(retryAfter) != 0 {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// perIPListener refuses connections from client IPs that already hold the maximum number of open connections,
+// so a single client cannot exhaust the server with idle or slow connections
+type perIPListener struct {
+	net.Listener
+	max int
+
+	mu    sync.Mutex
+	conns map[string]int
+}
+
+// limitConnectionsPerIP wraps the listener to accept at most max simultaneous connections per client IP
+func limitConnectionsPerIP(l net.Listener, max int) net.Listener {
+	return &perIPListener{Listener: l, max: max, conns: make(map[string]int)}
+}
+
+// Accept returns the next connection of a client IP below the limit, closing the refused ones
+func (l *perIPListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		ip := conn.RemoteAddr().String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+		l.mu.Lock()
+		if l.conns[ip] >= l.max {
+			l.mu.Unlock()
+			logger.Errorf("Connection limit of %d per IP reached, refusing connection from %s", l.max, ip)
+			_ = conn.Close()
+			continue
+		}
+		l.conns[ip]++
+		l.mu.Unlock()
+		return &perIPConn{Conn: conn, listener: l, ip: ip}, nil
+	}
+}
+
+// release frees the connection slot of the IP
+func (l *perIPListener) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conns[ip]--; l.conns[ip] <= 0 {
+		delete(l.conns, ip)
+	}
+}
+
+// perIPConn frees its slot of the client IP when closed
+type perIPConn struct {
+	net.Conn
+	listener *perIPListener
+	ip       string
+	once     sync.Once
+}
+
+func (c *perIPConn) Close() error {
+	c.once.Do(func() { c.listener.release(c.ip) })
+	return c.Conn.Close()
+}
@@ -0,0 +1,161 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// colorCodes matches the terminal color codes used by the standard logger
+var colorCodes = regexp.MustCompile("\033\\[[0-9;]*m")
+
+// Logger receives the router's log messages, formatted like fmt.Printf and without colors
+type Logger interface {
+	Debugf(format string, args ...any)
+	Infof(format string, args ...any)
+	Warnf(format string, args ...any)
+	Errorf(format string, args ...any)
+}
+
+// logger is the logger of the router, replaced through SetLogger to integrate another logging stack
+var logger Logger = stdLogger{}
+
+// SetLogger replaces the logger of the router, nil restores the standard logger
+func SetLogger(l Logger) {
+	if l == nil {
+		l = stdLogger{}
+	}
+	logger = l
+}
+
+// stdLogger writes to the standard log package, coloring messages by level
+type stdLogger struct{}
+
+func (stdLogger) Debugf(format string, args ...any) { stdLog(ColorCyan, format, args) }
+func (stdLogger) Infof(format string, args ...any)  { stdLog(ColorGreen, format, args) }
+func (stdLogger) Warnf(format string, args ...any)  { stdLog(ColorYellow, format, args) }
+func (stdLogger) Errorf(format string, args ...any) { stdLog(ColorRed, format, args) }
+
+func stdLog(color, format string, args []any) {
+	log.Printf(color+format+ColorReset, args...)
+}
+
+// Log formats selected with --log-format
+const (
+	LogFormatText   = "text"   // Colored messages prefixed with the time
+	LogFormatJSON   = "json"   // One JSON object per message
+	LogFormatLogfmt = "logfmt" // One line of key=value pairs per message
+)
+
+// newFormatLogger returns the logger writing messages in the format
+func newFormatLogger(format string) (Logger, error) {
+	switch format {
+	case "", LogFormatText:
+		return stdLogger{}, nil
+	case LogFormatJSON:
+		return structuredLogger{encode: encodeJSON}, nil
+	case LogFormatLogfmt:
+		return structuredLogger{encode: encodeLogfmt}, nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expected text, json or logfmt", format)
+	}
+}
+
+// logField is a key and value of a structured log record, values are strings or numbers
+type logField struct {
+	key   string
+	value any
+}
+
+// structuredLogger writes every message as a record of the time, level and message to the output of the
+// standard log package, so the logging config applies
+type structuredLogger struct {
+	encode func(fields []logField) string
+}
+
+func (l structuredLogger) Debugf(format string, args ...any) { l.log("debug", format, args) }
+func (l structuredLogger) Infof(format string, args ...any)  { l.log("info", format, args) }
+func (l structuredLogger) Warnf(format string, args ...any)  { l.log("warn", format, args) }
+func (l structuredLogger) Errorf(format string, args ...any) { l.log("error", format, args) }
+
+func (l structuredLogger) log(level, format string, args []any) {
+	l.logFields(level, fmt.Sprintf(format, args...), nil)
+}
+
+// logFields writes a record of the message followed by the fields
+func (l structuredLogger) logFields(level, msg string, fields []logField) {
+	line := l.encode(append([]logField{
+		{"time", time.Now().Format(time.RFC3339Nano)},
+		{"level", level},
+		{"msg", msg},
+	}, fields...))
+	_, _ = log.Writer().Write([]byte(line + "\n"))
+}
+
+// logAccess logs the completion of a request. The structured formats record the method, path, route, status
+// and duration as fields of their own, other loggers receive them in the message. Status 0 means the client
+// went away before a response was written.
+func logAccess(method, path, route string, status int, duration time.Duration) {
+	if l, ok := logger.(structuredLogger); ok {
+		l.logFields("info", "Completed request", []logField{
+			{"method", method},
+			{"path", path},
+			{"route", route},
+			{"status", status},
+			{"duration_ms", duration.Milliseconds()},
+		})
+		return
+	}
+	logger.Infof("Completed request: %s %s %d in %dms (route %s)", method, path, status, duration.Milliseconds(), route)
+}
+
+// encodeJSON encodes the fields as a JSON object, keeping their order
+func encodeJSON(fields []logField) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, field := range fields {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(field.key)
+		value, _ := json.Marshal(field.value)
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// encodeLogfmt encodes the fields as key=value pairs, quoting values that are empty or contain spaces,
+// quotes, equal signs or control characters
+func encodeLogfmt(fields []logField) string {
+	var b strings.Builder
+	for i, field := range fields {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(field.key)
+		b.WriteByte('=')
+		value := fmt.Sprint(field.value)
+		if len(value) == 0 || strings.ContainsFunc(value, func(r rune) bool {
+			return r <= ' ' || r == '"' || r == '=' || r == 0x7f
+		}) {
+			b.WriteString(strconv.Quote(value))
+		} else {
+			b.WriteString(value)
+		}
+	}
+	return b.String()
+}
+
+// fatalf logs the error and exits the process
+func fatalf(format string, args ...any) {
+	logger.Errorf(format, args...)
+	os.Exit(1)
+}
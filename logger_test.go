@@ -0,0 +1,56 @@
+package router
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// captureLogs sends the records of the logger to a buffer until the test ends
+func captureLogs(t *testing.T, l Logger) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	output, flags, previous := log.Writer(), log.Flags(), logger
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	SetLogger(l)
+	t.Cleanup(func() {
+		log.SetOutput(output)
+		log.SetFlags(flags)
+		SetLogger(previous)
+	})
+	return &buf
+}
+
+func TestAccessLog(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{LogFormatLogfmt, `msg="Completed request" method=POST path=/x route=api status=201 duration_ms=`},
+		{LogFormatJSON, `"msg":"Completed request","method":"POST","path":"/x","route":"api","status":201,"duration_ms":`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			l, err := newFormatLogger(tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := captureLogs(t, l)
+
+			handler := accessLog(RedirectConfig{Name: "api", Path: "/"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/x?token=secret", nil))
+
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if len(lines) != 2 || !strings.Contains(lines[1], tt.want) {
+				t.Errorf("got records %q, want the second to contain %q", lines, tt.want)
+			}
+		})
+	}
+}
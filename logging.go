@@ -0,0 +1,38 @@
+package router
+
+import (
+	"log"
+	"os"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// LoggingConfig controls where logs are written and how log files are rotated
+type LoggingConfig struct {
+	File       string `mapstructure:"file"`        // Log file path, logs go to stderr if empty
+	MaxSize    int    `mapstructure:"max_size"`    // Maximum size in megabytes before rotating
+	MaxBackups int    `mapstructure:"max_backups"` // Maximum number of rotated files to keep
+	MaxAge     int    `mapstructure:"max_age"`     // Maximum number of days to keep rotated files
+	Compress   bool   `mapstructure:"compress"`    // Gzip rotated files
+
+	RedactQuery   []string `mapstructure:"redact_query"`   // Query parameters whose values are hidden in logs
+	RedactHeaders []string `mapstructure:"redact_headers"` // Headers whose values are hidden in logs
+}
+
+// setupLogging configures the standard logger output and log redaction according to the logging config
+func setupLogging(cfg LoggingConfig) {
+	logRedactor = newRedactor(cfg.RedactQuery, cfg.RedactHeaders)
+
+	if len(cfg.File) == 0 {
+		log.SetOutput(os.Stderr)
+		return
+	}
+
+	log.SetOutput(&lumberjack.Logger{
+		Filename:   cfg.File,
+		MaxSize:    cfg.MaxSize,
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     cfg.MaxAge,
+		Compress:   cfg.Compress,
+	})
+}
@@ -1,21 +1,23 @@
-package main
+package router
 
 import (
+	"cmp"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"maps"
+	"net"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
 	"os"
 	"os/signal"
+	"slices"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/websocket"
-	"github.com/spf13/viper"
 )
 
 // ANSI color codes for terminal
@@ -30,273 +32,1005 @@ const (
 	ColorWhite  = "\033[37m"
 )
 
+// Largest response body buffered for caching or compressed unless configured otherwise
+const defaultMaxBufferSize = 1 << 20
+
 type RedirectConfig struct {
-	Path string `mapstructure:"path"`
-	Host string `mapstructure:"host"`
-	Port int    `mapstructure:"port"`
+	Name     string         `mapstructure:"name"` // Identifies the route in logs, defaults to its path
+	Path     string         `mapstructure:"path"`
+	Priority int            `mapstructure:"priority"` // Routes with a higher priority are matched first, regardless of path length
+	Host     string         `mapstructure:"host"`
+	Port     int            `mapstructure:"port"`
+	Targets  []TargetConfig `mapstructure:"targets"`  // Multiple backends, overrides host and port
+	Strategy string         `mapstructure:"strategy"` // round_robin (default) or random
+	Enabled  *bool          `mapstructure:"enabled"`  // Defaults to true when omitted
+
+	// Duration a target is avoided after a failed request, defaults to 10s
+	FailTimeout time.Duration `mapstructure:"fail_timeout"`
+
+	// Requests in flight to host and port at once when no targets are listed, unlimited when zero
+	MaxConns int `mapstructure:"max_conns"`
+
+	// Requests waiting for a connection slot when every target reached max_conns
+	Queue QueueConfig `mapstructure:"queue"`
+
+	// Timeout of the WebSocket handshake with the backend, inherits the server value when zero
+	HandshakeTimeout time.Duration `mapstructure:"handshake_timeout"`
+
+	// Accept WebSocket upgrades on the route, defaults to true
+	WebSocket *bool `mapstructure:"websocket"`
+
+	// Negotiate permessage-deflate on both WebSocket legs when the client offers it
+	WSCompression bool `mapstructure:"ws_compression"`
+
+	// Size of the read and write buffers of both WebSocket legs, defaults to 4096 bytes
+	WSBufferSize int `mapstructure:"ws_buffer_size"`
+
+	// Close WebSocket bridges no message crossed in either direction for this long, never when zero
+	WSIdleTimeout time.Duration `mapstructure:"ws_idle_timeout"`
+
+	// Origins allowed to open WebSocket connections, inherits the server value when empty
+	AllowedOrigins []string `mapstructure:"allowed_origins"`
+
+	ForwardedHeaders *bool `mapstructure:"forwarded_headers"` // Inject X-Forwarded-* headers, defaults to true
+	XForwardedFor    *bool `mapstructure:"x_forwarded_for"`   // Set X-Forwarded-For to the client IP, defaults to true
+	XRealIP          *bool `mapstructure:"x_real_ip"`         // Set X-Real-IP to the client IP, defaults to true
+	PreserveHost     *bool `mapstructure:"preserve_host"`     // Forward the client Host header, defaults to true
+
+	SetUserAgent    string `mapstructure:"set_user_agent"`    // User-Agent sent to the backend instead of the client's
+	RemoveUserAgent bool   `mapstructure:"remove_user_agent"` // Send no User-Agent to the backend
+
+	Compression CompressionConfig `mapstructure:"compression"`
+	Maintenance MaintenanceConfig `mapstructure:"maintenance"`
+	Cache       CacheConfig       `mapstructure:"cache"`
+	Canary      CanaryConfig      `mapstructure:"canary"`
+
+	// Decode gzip and deflate responses for clients that did not ask for the encoding
+	Decompress bool `mapstructure:"decompress"`
+
+	// Decode gzip and deflate encoded request bodies before forwarding them
+	DecompressRequest DecompressRequestConfig `mapstructure:"decompress_request"`
+
+	// Let concurrent identical GET requests share a single upstream fetch
+	Coalesce bool `mapstructure:"coalesce"`
+
+	// Replay the first response to requests repeating an Idempotency-Key header
+	Idempotency IdempotencyConfig `mapstructure:"idempotency"`
+
+	// Ask the backend for trailers on behalf of every client and keep responses with trailers out of the cache
+	Trailers bool `mapstructure:"trailers"`
+
+	// Backend response statuses rewritten to other statuses, e.g. {500: 502}
+	StatusMap map[int]int `mapstructure:"status_map"`
+
+	// Standard security headers added to the responses of the route
+	SecurityHeaders SecurityHeadersConfig `mapstructure:"security_headers"`
+
+	// External commands the request and response bodies are piped through
+	Transform TransformConfig `mapstructure:"transform"`
+
+	// Backend receiving a copy of every proxied request, its responses are discarded
+	Mirror *TargetConfig `mapstructure:"mirror"`
+
+	// Largest response body buffered for caching or compressed, larger ones are streamed as is, defaults to 1MiB
+	MaxBufferSize int64 `mapstructure:"max_buffer_size"`
+
+	// Add an X-Route-Name header with the route name to responses
+	NameHeader bool `mapstructure:"name_header"`
+
+	// Log request and response bodies for debugging, off by default as bodies may hold private data
+	LogBodies BodyLogConfig `mapstructure:"log_bodies"`
+
+	Log       *bool `mapstructure:"log"`        // Log each request of the route, defaults to true
+	LogSample int   `mapstructure:"log_sample"` // Log only 1 in N requests when greater than 1
+
+	HTTP2    bool   `mapstructure:"http2"`    // Speak HTTP/2 over cleartext (h2c) to the backend
+	Protocol string `mapstructure:"protocol"` // http (default) or grpc
+
+	// Compatibility with HTTP/1.0 and other legacy backends that mishandle persistent connections
+	ConnectionClose   bool `mapstructure:"connection_close"`    // Send Connection: close on every forwarded request
+	DisableKeepAlives bool `mapstructure:"disable_keep_alives"` // Open a new backend connection for every request
+
+	// Forward proxy backends are reached through, overriding the global upstream_proxy; "direct" bypasses proxies
+	UpstreamProxy string `mapstructure:"upstream_proxy"`
+
+	// Time backend host name resolutions are reused, overriding the global dns_cache_ttl; negative values disable caching
+	DNSCacheTTL time.Duration `mapstructure:"dns_cache_ttl"`
+
+	StripPrefix   bool   `mapstructure:"strip_prefix"`   // Remove the route path from the forwarded path
+	TargetPrefix  string `mapstructure:"target_prefix"`  // Prepend this path to the forwarded path
+	TrailingSlash string `mapstructure:"trailing_slash"` // preserve (default), strip or add
+
+	// Interval between response flushes to the client, negative values flush after every write
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+
+	// Grace period of requests in flight when a reload changes or removes the route, defaults to 30s
+	DrainTimeout time.Duration `mapstructure:"drain_timeout"`
+
+	// Deadline of the whole upstream request, exceeding it cancels the request and responds 504
+	RequestTimeout time.Duration `mapstructure:"request_timeout"`
+
+	// Proxied requests taking longer are logged as slow and counted in the router_slow_requests_total metric
+	SlowThreshold time.Duration `mapstructure:"slow_threshold"`
+
+	RetryOnStatus []int         `mapstructure:"retry_on_status"` // Response statuses of idempotent requests retried on another target
+	RetryAttempts int           `mapstructure:"retry_attempts"`  // Retries after the first attempt, defaults to 2
+	RetryBackoff  time.Duration `mapstructure:"retry_backoff"`   // Delay before the first retry, doubled for each further one, defaults to 100ms
+	RetryMaxTime  time.Duration `mapstructure:"retry_max_time"`  // Total time spent waiting for retries, defaults to 5s
+
+	// Buffer request bodies so requests with a body, such as POST, are retried on connection failures and retry_on_status
+	BufferRequestBody BufferBodyConfig `mapstructure:"buffer_request_body"`
+
+	Methods []string `mapstructure:"methods"` // Accepted HTTP methods, all methods when empty
+
+	// Request headers and the values the route requires, e.g. {X-Tenant: acme}; "*" in a value matches any text
+	MatchHeaders map[string]string `mapstructure:"match_headers"`
+
+	// Forward HEAD requests as GET for backends that do not implement HEAD, the client still receives no body
+	HeadAsGet bool `mapstructure:"head_as_get"`
+
+	// Accepted Content-Type media types of request bodies, entries ending with "/" match a whole type
+	AllowedContentTypes []string `mapstructure:"allowed_content_types"`
+
+	StaticDir string `mapstructure:"static_dir"` // Serve files from this directory instead of proxying
+	SPA       bool   `mapstructure:"spa"`        // Serve index.html of static_dir for paths that do not exist
+
+	balancer   *balancer
+	canary     *balancer
+	logCounter *atomic.Uint64
+	transport  http.RoundTripper
+	errorPage  ErrorPageConfig
+	cache      *responseCache
+	static     http.Handler
+	handler    http.Handler // Middleware chain serving the HTTP requests of the route
+	drain      *routeDrain
+	wsMetrics  *wsMetrics
+	metrics    *routeMetrics
+	servedBy   string
+	dnsCache   *dnsCache
+	queue      *requestQueue
+
+	clientCertHeaders bool
+}
+
+// label returns the name identifying the route in logs, its path when no name is set
+func (r RedirectConfig) label() string {
+	if len(r.Name) == 0 {
+		return r.Path
+	}
+	return r.Name
+}
+
+// targetList returns the backends of the route, using its host and port when no targets are listed
+func (r RedirectConfig) targetList() []TargetConfig {
+	if len(r.Targets) == 0 {
+		return []TargetConfig{{Host: r.Host, Port: r.Port, MaxConns: r.MaxConns}}
+	}
+	return r.Targets
+}
+
+// balancerFor returns the balancer serving the request, splitting traffic to the canary targets when configured
+func (r RedirectConfig) balancerFor(req *http.Request) *balancer {
+	if r.canary != nil && r.Canary.selects(req) {
+		return r.canary
+	}
+	return r.balancer
+}
+
+// bufferLimit returns the largest response body the route buffers for caching or compresses
+func (r RedirectConfig) bufferLimit() int64 {
+	if r.MaxBufferSize <= 0 {
+		return defaultMaxBufferSize
+	}
+	return r.MaxBufferSize
+}
+
+// retryAttempts returns the number of retries after a response with a retryable status
+func (r RedirectConfig) retryAttempts() int {
+	if r.RetryAttempts <= 0 {
+		return defaultRetryAttempts
+	}
+	return r.RetryAttempts
+}
+
+// retryBackoff returns the delay before the first retry
+func (r RedirectConfig) retryBackoff() time.Duration {
+	if r.RetryBackoff <= 0 {
+		return defaultRetryBackoff
+	}
+	return r.RetryBackoff
+}
+
+// retryMaxTime returns the longest time spent on retries of a request
+func (r RedirectConfig) retryMaxTime() time.Duration {
+	if r.RetryMaxTime <= 0 {
+		return defaultRetryMaxTime
+	}
+	return r.RetryMaxTime
+}
+
+// applyUserAgent replaces or removes the User-Agent of a request to the backend as configured for the route
+func (r RedirectConfig) applyUserAgent(header http.Header) {
+	switch {
+	case r.RemoveUserAgent:
+		// An empty value keeps both the reverse proxy and the transport from adding a default one
+		header.Set("User-Agent", "")
+	case len(r.SetUserAgent) != 0:
+		header.Set("User-Agent", r.SetUserAgent)
+	}
+}
+
+// allowsMethod reports whether the route accepts the HTTP method
+func (r RedirectConfig) allowsMethod(method string) bool {
+	if len(r.Methods) == 0 {
+		return true
+	}
+	for _, m := range r.Methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesHeaders reports whether the request headers have the values required by the route
+func (r RedirectConfig) matchesHeaders(header http.Header) bool {
+	for name, pattern := range r.MatchHeaders {
+		values := header.Values(name)
+		if !slices.ContainsFunc(values, func(value string) bool { return matchWildcard(pattern, value) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchWildcard reports whether the value matches the pattern, where "*" matches any text including none
+func matchWildcard(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(value, part)
+		if i < 0 {
+			return false
+		}
+		value = value[i+len(part):]
+	}
+	return strings.HasSuffix(value, parts[len(parts)-1])
+}
+
+// overlapsMethods reports whether a request method could be accepted by both routes
+func (r RedirectConfig) overlapsMethods(other RedirectConfig) bool {
+	if len(r.Methods) == 0 || len(other.Methods) == 0 {
+		return len(r.Methods) == len(other.Methods)
+	}
+	for _, m := range r.Methods {
+		if other.allowsMethod(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchKey identifies the route among the routes of its server by path, methods and matched headers
+func (r RedirectConfig) matchKey() string {
+	headers := make([]string, 0, len(r.MatchHeaders))
+	for name, value := range r.MatchHeaders {
+		headers = append(headers, http.CanonicalHeaderKey(name)+"="+value)
+	}
+	slices.Sort(headers)
+	return r.Path + " " + strings.ToUpper(strings.Join(r.Methods, ",")) + " " + strings.Join(headers, ",")
+}
+
+// shouldLog reports whether the current request of the route should be access logged
+func (r RedirectConfig) shouldLog() bool {
+	if !boolValue(r.Log, true) {
+		return false
+	}
+	if r.LogSample <= 1 {
+		return true
+	}
+	return (r.logCounter.Add(1)-1)%uint64(r.LogSample) == 0
+}
+
+// IsEnabled reports whether the route should be used for matching
+func (r RedirectConfig) IsEnabled() bool {
+	return boolValue(r.Enabled, true)
 }
 
 type ServerConfig struct {
-	Server   int              `mapstructure:"server"`
+	Server   int              `mapstructure:"server"`  // Port to listen on, 0 binds a port assigned by the OS
+	Enabled  *bool            `mapstructure:"enabled"` // Defaults to true when omitted
 	Redirect []RedirectConfig `mapstructure:"redirect"`
+
+	// Ports to bind the first free one of instead of server, e.g. "8000-8100"
+	PortRange string `mapstructure:"port_range"`
+
+	// Ports that all serve the routes and settings of this block instead of server
+	Ports []int `mapstructure:"ports"`
+
+	// Serve HTTPS with this certificate instead of HTTP
+	TLS TLSConfig `mapstructure:"tls"`
+
+	// Redirect every request to HTTPS instead of proxying
+	RedirectToHTTPS HTTPSRedirectConfig `mapstructure:"redirect_to_https"`
+
+	// Default timeout of WebSocket handshakes with backends
+	HandshakeTimeout time.Duration `mapstructure:"handshake_timeout"`
+
+	// Default origins allowed to open WebSocket connections, only same-host origins when empty
+	AllowedOrigins []string `mapstructure:"allowed_origins"`
+
+	// Maintenance response served for every request of the server
+	Maintenance MaintenanceConfig `mapstructure:"maintenance"`
+
+	// Accept HTTP/2 over cleartext (h2c) connections
+	H2C bool `mapstructure:"h2c"`
+
+	MaxConcurrentRequests int    `mapstructure:"max_concurrent_requests"` // Requests served at once, unlimited when zero
+	MaxConnections        int    `mapstructure:"max_connections"`         // Accepted connections at once, unlimited when zero
+	MaxConnsPerIP         int    `mapstructure:"max_conns_per_ip"`        // Open connections of a single client IP, unlimited when zero
+	OverloadRetryAfter    string `mapstructure:"overload_retry_after"`    // Retry-After value sent when the request limit is reached
+
+	// Serve the effective routing table as JSON on /__routes
+	DebugRoutes bool `mapstructure:"debug_routes"`
+
+	// Serve the router readiness on /healthz
+	Healthz bool `mapstructure:"healthz"`
+
+	// Serve the build information of the router on /version
+	Version bool `mapstructure:"version"`
+
+	// Serve Prometheus metrics on /metrics
+	Metrics bool `mapstructure:"metrics"`
+
+	// Response sent to clients when a backend fails or times out
+	ErrorPage ErrorPageConfig `mapstructure:"error_page"`
+
+	// Response sent for requests matching no route, defaults to the standard 404 page
+	NotFound NotFoundConfig `mapstructure:"not_found"`
+
+	// Largest size in bytes of request headers, larger ones receive 431, defaults to 1MiB
+	MaxHeaderBytes int `mapstructure:"max_header_bytes"`
+
+	// Describe the TLS client certificate of requests in X-Client-Cert-* headers sent to backends
+	ClientCertHeaders bool `mapstructure:"client_cert_headers"`
+
+	// Add an X-Served-By header identifying this router instance to proxied responses
+	ServedBy bool `mapstructure:"served_by"`
+
+	TCPKeepAlive       *bool         `mapstructure:"tcp_keep_alive"`        // Send TCP keep-alive probes on accepted connections, defaults to true
+	TCPKeepAlivePeriod time.Duration `mapstructure:"tcp_keep_alive_period"` // Interval between keep-alive probes, the Go default (15s) when zero
+
+	// Bind the port with SO_REUSEPORT so a new router process can bind it while the old one drains
+	ReusePort bool `mapstructure:"reuse_port"`
+
+	routes *routeTrie // Index of Redirect for matching requests, built by prepareServers
 }
 
-type Config struct {
-	Router []ServerConfig `mapstructure:"router"`
+// hasGRPCRoutes reports whether any enabled route of the server proxies gRPC
+func (s ServerConfig) hasGRPCRoutes() bool {
+	for _, route := range s.Redirect {
+		if route.IsEnabled() && route.Protocol == ProtocolGRPC {
+			return true
+		}
+	}
+	return false
 }
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+// IsEnabled reports whether the server should bind its port
+func (s ServerConfig) IsEnabled() bool {
+	return boolValue(s.Enabled, true)
 }
 
-func main() {
-	// Configure viper
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath(".")
+// listenConfig returns the TCP settings used to accept connections of the server
+func (s ServerConfig) listenConfig() *net.ListenConfig {
+	lc := &net.ListenConfig{KeepAlive: s.TCPKeepAlivePeriod}
+	if !boolValue(s.TCPKeepAlive, true) {
+		lc.KeepAlive = -1
+	}
+	if s.ReusePort {
+		lc.Control = reusePort
+	}
+	return lc
+}
 
-	// Read configuration file
-	if err := viper.ReadInConfig(); err != nil {
-		log.Fatalf("Failed to read config file: %v", err)
+// enabledRoutes returns the routes of the server that are not disabled, ready for matching
+func (s ServerConfig) enabledRoutes() []RedirectConfig {
+	routes := make([]RedirectConfig, 0, len(s.Redirect))
+	for _, route := range s.Redirect {
+		if route.IsEnabled() {
+			if route.HandshakeTimeout == 0 {
+				route.HandshakeTimeout = s.HandshakeTimeout
+			}
+			if len(route.AllowedOrigins) == 0 {
+				route.AllowedOrigins = s.AllowedOrigins
+			}
+			if route.HandshakeTimeout == 0 {
+				route.HandshakeTimeout = websocket.DefaultDialer.HandshakeTimeout
+			}
+			route.balancer = newBalancer(route)
+			if route.Canary.enabled() {
+				route.canary = newTargetBalancer(route.Canary.Targets, route.Strategy, route.FailTimeout)
+			}
+			route.logCounter = &atomic.Uint64{}
+			route.drain = newRouteDrain()
+			route.wsMetrics = newWSMetrics(s.portLabel(), route.label())
+			route.metrics = newRouteMetrics(s.portLabel(), route.label())
+			route.errorPage = s.ErrorPage
+			route.clientCertHeaders = s.ClientCertHeaders
+			route.cache = newResponseCache(route.Cache)
+			route.dnsCache = newDNSCache(route.DNSCacheTTL)
+			route.queue = newRequestQueue(route.Queue)
+			if len(route.StaticDir) != 0 {
+				route.static = newStaticHandler(route)
+			}
+			if route.HTTP2 || route.Protocol == ProtocolGRPC {
+				route.transport = newH2CTransport(route.dialContext())
+			} else {
+				route.transport = newRouteTransport(route)
+			}
+			routes = append(routes, route)
+		}
 	}
+	return routes
+}
 
-	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
-		log.Fatalf("Failed to parse config file: %v", err)
+type Config struct {
+	Logging LoggingConfig  `mapstructure:"logging"`
+	Router  []ServerConfig `mapstructure:"router"`
+
+	// Dial every backend at startup and warn about unreachable ones
+	CheckBackendsOnStart bool `mapstructure:"check_backends_on_start"`
+
+	// Report the router ready on /healthz only once the backends are reachable
+	Warmup WarmupConfig `mapstructure:"warmup"`
+
+	// File the goroutine stack traces are written to on SIGUSR1, nothing is written when empty
+	StatsDumpFile string `mapstructure:"stats_dump_file"`
+
+	// Name of this router instance, used in the X-Served-By response header
+	ServerName string `mapstructure:"server_name"`
+
+	// Proxies in front of the router, as CIDR ranges or IP addresses, whose X-Forwarded-For header is trusted
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+
+	// Allow routes to run the external commands of their transform option
+	AllowTransforms bool `mapstructure:"allow_transforms"`
+
+	// Size in bytes of the pooled buffers used to copy response bodies, defaults to 32KiB
+	ProxyBufferSize int `mapstructure:"proxy_buffer_size"`
+
+	// Forward proxy backends are reached through, HTTP_PROXY, HTTPS_PROXY and NO_PROXY are honored when empty
+	UpstreamProxy string `mapstructure:"upstream_proxy"`
+
+	// Time backend host name resolutions are reused by new connections, every connection resolves the host when zero
+	DNSCacheTTL time.Duration `mapstructure:"dns_cache_ttl"`
+
+	// Authenticated endpoints to reload the config and inspect the routes, on a port of their own
+	Admin AdminConfig `mapstructure:"admin"`
+}
+
+// expandEnv replaces ${VAR} and $VAR references in string config fields with values from the process environment.
+// The servers, routes and targets are copied first, so a config passed by value leaves the caller's untouched.
+func (c *Config) expandEnv() {
+	c.Logging.File = os.ExpandEnv(c.Logging.File)
+	c.ServerName = os.ExpandEnv(c.ServerName)
+	c.UpstreamProxy = os.ExpandEnv(c.UpstreamProxy)
+	c.Admin.Token = os.ExpandEnv(c.Admin.Token)
+	c.Router = slices.Clone(c.Router)
+	for i := range c.Router {
+		c.Router[i].Redirect = slices.Clone(c.Router[i].Redirect)
+		c.Router[i].NotFound.File = os.ExpandEnv(c.Router[i].NotFound.File)
+		c.Router[i].TLS.CertFile = os.ExpandEnv(c.Router[i].TLS.CertFile)
+		c.Router[i].TLS.KeyFile = os.ExpandEnv(c.Router[i].TLS.KeyFile)
+		c.Router[i].TLS.ClientCAFile = os.ExpandEnv(c.Router[i].TLS.ClientCAFile)
+		c.Router[i].TLS.Autocert.CacheDir = os.ExpandEnv(c.Router[i].TLS.Autocert.CacheDir)
+		for j := range c.Router[i].Redirect {
+			route := &c.Router[i].Redirect[j]
+			route.Path = os.ExpandEnv(route.Path)
+			route.Host = os.ExpandEnv(route.Host)
+			route.TargetPrefix = os.ExpandEnv(route.TargetPrefix)
+			route.StaticDir = os.ExpandEnv(route.StaticDir)
+			route.UpstreamProxy = os.ExpandEnv(route.UpstreamProxy)
+			route.Targets = slices.Clone(route.Targets)
+			route.Canary.Targets = slices.Clone(route.Canary.Targets)
+			for k := range route.Targets {
+				route.Targets[k].Host = os.ExpandEnv(route.Targets[k].Host)
+			}
+			for k := range route.Canary.Targets {
+				route.Canary.Targets[k].Host = os.ExpandEnv(route.Canary.Targets[k].Host)
+			}
+		}
 	}
+}
 
-	// Setup signal catching
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+// mergeServers combines enabled server blocks that share a port into a single server whose routes are
+// the concatenation of all blocks, the settings of the first block apply to the merged server. Servers
+// whose port is only known once bound are never merged.
+func mergeServers(servers []ServerConfig) ([]ServerConfig, error) {
+	merged := make([]ServerConfig, 0, len(servers))
+	index := make(map[int]int, len(servers))
+	paths := make(map[int]map[string][]RedirectConfig, len(servers))
+	for _, server := range servers {
+		if !server.IsEnabled() {
+			merged = append(merged, server)
+			continue
+		}
+
+		// Negative keys are unique to a single server block
+		key := server.Server
+		if server.dynamicPort() {
+			key = -len(merged) - 1
+		}
 
-	var wg sync.WaitGroup
-	// Channel to collect all server instances for graceful shutdown
-	servers := make([]*http.Server, 0, len(config.Router))
-	serversMutex := sync.Mutex{}
-
-	// Start a server for each server configuration
-	for _, serverConfig := range config.Router {
-		wg.Add(1)
-		// Use goroutine to start each server
-		go func(serverCfg ServerConfig) {
-			defer wg.Done()
-
-			// Create route handler
-			mux := http.NewServeMux()
-			mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-				// Check if it's a WebSocket request
-				if websocket.IsWebSocketUpgrade(r) {
-					handleWebSocket(w, r, serverCfg.Redirect)
-					return
+		if _, ok := paths[key]; !ok {
+			paths[key] = make(map[string][]RedirectConfig, len(server.Redirect))
+		}
+		for _, route := range server.Redirect {
+			if !route.IsEnabled() {
+				continue
+			}
+			for _, other := range paths[key][route.Path] {
+				if route.overlapsMethods(other) && maps.Equal(route.MatchHeaders, other.MatchHeaders) {
+					return nil, fmt.Errorf("duplicate route path %q on port %s", route.Path, server.portLabel())
 				}
+			}
+			paths[key][route.Path] = append(paths[key][route.Path], route)
+		}
+
+		if i, ok := index[key]; ok {
+			merged[i].Redirect = append(merged[i].Redirect, server.Redirect...)
+			continue
+		}
+
+		server.Redirect = append([]RedirectConfig(nil), server.Redirect...)
+		index[key] = len(merged)
+		merged = append(merged, server)
+	}
+	return merged, nil
+}
+
+// prepareServers merges server blocks sharing a port and drops disabled routes so they are neither matched nor logged
+func prepareServers(config Config) ([]ServerConfig, error) {
+	if config.Admin.enabled() {
+		if err := config.Admin.validate(); err != nil {
+			return nil, err
+		}
+	}
 
-				// Handle HTTP request
-				handleHTTP(w, r, serverCfg.Redirect)
-			})
+	servers, err := expandPorts(config.Router)
+	if err != nil {
+		return nil, err
+	}
+	servers, err = mergeServers(servers)
+	if err != nil {
+		return nil, err
+	}
 
-			// Configure server with proper shutdown
-			addr := fmt.Sprintf(":%d", serverCfg.Server)
-			srv := &http.Server{
-				Addr:    addr,
-				Handler: mux,
+	for i := range servers {
+		if !servers[i].IsEnabled() {
+			continue
+		}
+		if err := servers[i].validatePort(); err != nil {
+			return nil, err
+		}
+		if servers[i].TLS.enabled() {
+			if err := servers[i].TLS.validate(); err != nil {
+				return nil, fmt.Errorf("server on port %s: %w", servers[i].portLabel(), err)
 			}
+		}
+		if err := servers[i].ErrorPage.validate(); err != nil {
+			return nil, fmt.Errorf("server on port %s: %w", servers[i].portLabel(), err)
+		}
+		if err := servers[i].RedirectToHTTPS.validate(); err != nil {
+			return nil, fmt.Errorf("server on port %s: %w", servers[i].portLabel(), err)
+		}
+		// Redirecting HTTPS requests to HTTPS would send clients around in a loop
+		if servers[i].RedirectToHTTPS.Enabled && servers[i].TLS.enabled() {
+			return nil, fmt.Errorf("server on port %s: redirect_to_https cannot be combined with tls, list the HTTPS ports in tls.ports instead", servers[i].portLabel())
+		}
+		if err := servers[i].NotFound.load(); err != nil {
+			return nil, fmt.Errorf("server on port %s: %w", servers[i].portLabel(), err)
+		}
 
-			// Add server to the list for shutdown
-			serversMutex.Lock()
-			servers = append(servers, srv)
-			serversMutex.Unlock()
-
-			// Log server routes
-			writer := strings.Builder{}
-			writer.WriteString(fmt.Sprintf("%sServer starting on port %s%d%s with the following routes:",
-				ColorGreen, ColorCyan, serverCfg.Server, ColorReset))
-			for _, route := range serverCfg.Redirect {
-				host := route.Host
-				if len(host) == 0 {
-					host = "localhost"
+		// Validate upstream proxies before enabledRoutes builds the route transports
+		for j := range servers[i].Redirect {
+			route := &servers[i].Redirect[j]
+			h2 := route.HTTP2 || route.Protocol == ProtocolGRPC
+			if len(route.UpstreamProxy) == 0 && !h2 {
+				route.UpstreamProxy = config.UpstreamProxy
+			}
+			if route.DNSCacheTTL == 0 {
+				route.DNSCacheTTL = config.DNSCacheTTL
+			}
+			if _, err := parseUpstreamProxy(route.UpstreamProxy); err != nil {
+				return nil, fmt.Errorf("route %s on port %s: %w", route.label(), servers[i].portLabel(), err)
+			}
+			if len(route.UpstreamProxy) != 0 && route.UpstreamProxy != upstreamProxyDirect && h2 {
+				return nil, fmt.Errorf("route %s on port %s sets upstream_proxy, which HTTP/2 backends do not support", route.label(), servers[i].portLabel())
+			}
+		}
+		servers[i].Redirect = servers[i].enabledRoutes()
+		for _, route := range servers[i].Redirect {
+			if route.RemoveUserAgent && len(route.SetUserAgent) != 0 {
+				return nil, fmt.Errorf("route %s on port %s sets both set_user_agent and remove_user_agent", route.label(), servers[i].portLabel())
+			}
+			if (route.ConnectionClose || route.DisableKeepAlives) && (route.HTTP2 || route.Protocol == ProtocolGRPC) {
+				return nil, fmt.Errorf("route %s on port %s disables persistent connections, which HTTP/2 backends require", route.label(), servers[i].portLabel())
+			}
+			if route.Trailers && route.Coalesce {
+				return nil, fmt.Errorf("route %s on port %s sets both trailers and coalesce, coalesced responses cannot carry trailers", route.label(), servers[i].portLabel())
+			}
+			if err := route.Cache.validate(); err != nil {
+				return nil, fmt.Errorf("route %s on port %s: %w", route.label(), servers[i].portLabel(), err)
+			}
+			for from, to := range route.StatusMap {
+				if from < 200 || from > 599 || to < 200 || to > 599 {
+					return nil, fmt.Errorf("route %s on port %s maps status %d to %d, statuses must be between 200 and 599", route.label(), servers[i].portLabel(), from, to)
 				}
-				writer.WriteString(fmt.Sprintf("\n\t%s%s%s -> %s%s:%d%s",
-					ColorYellow, route.Path, ColorReset,
-					ColorGreen, host, route.Port, ColorReset))
 			}
-			log.Print(writer.String())
-
-			// Start server
-			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				log.Fatalf("%sFailed to start server on port %d: %v%s", ColorRed, serverCfg.Server, err, ColorReset)
+			if route.Transform.enabled() && !config.AllowTransforms {
+				return nil, fmt.Errorf("route %s on port %s sets transform, which requires allow_transforms", route.label(), servers[i].portLabel())
 			}
-			log.Printf("%sServer on port %d has been shutdown%s",
-				ColorYellow, serverCfg.Server, ColorReset)
-		}(serverConfig)
+		}
+		servers[i].buildRoutes(config.ServerName, servers[i].Server)
 	}
+	return servers, nil
+}
 
-	// Wait for interrupt signal
-	<-stop
-	log.Println("Received shutdown signal, gracefully shutting down...")
+// buildRoutes builds the handlers of the complete routes of the server listening on the port, which capture the
+// route config, and the trie matching them. Servers with port 0 or a port range are built again once bound, so
+// their X-Served-By name carries the bound port.
+func (s *ServerConfig) buildRoutes(serverName string, port int) {
+	if s.ServedBy {
+		name := serverName
+		if len(name) == 0 {
+			name = fmt.Sprintf("router:%d", port)
+		}
+		for j := range s.Redirect {
+			s.Redirect[j].servedBy = name
+		}
+	}
 
-	// Create a timeout context for shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	for j := range s.Redirect {
+		s.Redirect[j].handler = newRouteHandler(s.Redirect[j])
+	}
+	sortRoutes(s.Redirect)
+	s.routes = newRouteTrie(s.Redirect)
+}
 
-	// Shutdown all servers
-	shutdownWg := sync.WaitGroup{}
-	serversMutex.Lock()
-	for _, srv := range servers {
-		shutdownWg.Add(1)
-		go func(s *http.Server) {
-			defer shutdownWg.Done()
+var upgrader = websocket.Upgrader{}
 
-			if err := s.Shutdown(ctx); err != nil {
-				log.Printf("Error during server shutdown: %v", err)
-			}
-		}(srv)
+// Main runs the router command: it handles the subcommands, loads the config selected by the command-line
+// flags and serves it until the process receives SIGINT or SIGTERM
+func Main() {
+	// Subcommands
+	if len(os.Args) > 1 && os.Args[1] == "explain" {
+		if err := runExplain(os.Args[2:], os.Stdout); err != nil {
+			fatalf("Explain failed: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "version" {
+		runVersion(os.Stdout)
+		return
+	}
+
+	var source configSource
+	source.register(flag.CommandLine)
+	logFormat := flag.String("log-format", LogFormatText, "Log format: text, json or logfmt")
+	flag.Parse()
+
+	// Select the log format before anything is logged
+	formatLogger, err := newFormatLogger(*logFormat)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	SetLogger(formatLogger)
+
+	// Read configuration file
+	config, err := loadConfig(source)
+	if err != nil {
+		fatalf("Failed to load config: %v", err)
 	}
-	serversMutex.Unlock()
 
-	// Wait for all servers to complete graceful shutdown
-	shutdownChan := make(chan struct{})
+	// Setup signal catching
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
-		shutdownWg.Wait()
-		close(shutdownChan)
+		<-stop
+		logger.Infof("Received shutdown signal, gracefully shutting down...")
+		cancel()
 	}()
 
-	// Wait for either context timeout or all servers to shutdown
-	select {
-	case <-ctx.Done():
-		log.Println("Shutdown timed out, forcing exit")
-	case <-shutdownChan:
-		log.Println("All servers gracefully shut down")
+	// Reload the config from the same source
+	rt := newRouter(config, func() (Config, error) { return loadConfig(source) })
+	if err := rt.Run(ctx); err != nil {
+		fatalf("Failed to run router: %v", err)
 	}
 }
 
-func handleHTTP(w http.ResponseWriter, r *http.Request, routes []RedirectConfig) {
-	log.Printf("%sReceived request: %s%s", ColorYellow, r.URL.Path, ColorReset)
+// handleRequest matches the request to a route once and hands it to the WebSocket bridge when it is an
+// upgrade, or to the route's handler otherwise
+func handleRequest(w http.ResponseWriter, r *http.Request, routes *routeTrie, notFound NotFoundConfig, shutdown context.Context) {
+	upgrade := websocket.IsWebSocketUpgrade(r)
+	route, ok := routes.match(r.Method, r.URL.Path, r.Header)
+	if !ok {
+		if upgrade {
+			logger.Infof("Received WebSocket request: %s", r.URL.Path)
+			logger.Errorf("No matching WebSocket route found: %s", r.URL.Path)
+		} else {
+			logger.Infof("Received request: %s", r.URL.Path)
+			logger.Errorf("No matching route found: %s", r.URL.Path)
+		}
+		notFound.serve(w, r)
+		return
+	}
 
-	for _, route := range routes {
-		if strings.HasPrefix(r.URL.Path, route.Path) {
-			host := route.Host
-			if len(host) == 0 {
-				host = "localhost"
-			}
+	// Both handlers answer 405 when the route was only matched to reject the method
+	if upgrade {
+		handleWebSocket(w, r, route, shutdown)
+		return
+	}
+	route.handler.ServeHTTP(w, r)
+}
 
-			// Log routing match
-			log.Printf("%sMatched route: %s -> %s:%d%s", ColorGreen, route.Path, host, route.Port, ColorReset)
+// handleWebSocket bridges the WebSocket upgrade request to a backend of the matched route, closing the
+// bridge once the shutdown context is cancelled
+func handleWebSocket(w http.ResponseWriter, r *http.Request, route RedirectConfig, shutdown context.Context) {
+	logger.Infof("Received WebSocket request: %s", r.URL.Path)
 
-			// Build URL
-			targetURL, err := url.Parse(fmt.Sprintf("http://%s:%d", host, route.Port))
-			if err != nil {
-				log.Printf("%sFailed to parse target URL: %v%s", ColorRed, err, ColorReset)
-				http.Error(w, "Failed to parse target URL", http.StatusInternalServerError)
-				return
-			}
+	if !route.allowsMethod(r.Method) {
+		logger.Errorf("WebSocket method %s not allowed on route: %s", r.Method, route.label())
+		methodNotAllowed(w, route)
+		return
+	}
+	if route.Maintenance.Enabled {
+		logger.Warnf("WebSocket route under maintenance: %s", route.label())
+		route.Maintenance.serve(w)
+		return
+	}
+	if route.static != nil {
+		logger.Errorf("WebSocket request to static route rejected: %s", route.label())
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if !boolValue(route.WebSocket, true) {
+		logger.Errorf("WebSocket request to HTTP-only route rejected: %s", route.label())
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	// Reject disallowed origins before any backend connection is made
+	if !originAllowed(r, route.AllowedOrigins) {
+		logger.Errorf("WebSocket origin %q not allowed on route: %s", r.Header.Get("Origin"), route.label())
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	// Reject handshakes the client upgrade would fail before any backend connection is made
+	if status, err := checkUpgrade(w, r); err != nil {
+		logger.Errorf("WebSocket handshake rejected on route %s: %v", route.label(), err)
+		if status == http.StatusUpgradeRequired {
+			w.Header().Set("Sec-WebSocket-Version", "13")
+		}
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
 
-			// Create and configure reverse proxy
-			proxy := httputil.NewSingleHostReverseProxy(targetURL)
+	// Only request compression from the backend when the client offered it
+	dialer := websocket.Dialer{
+		Proxy:             route.proxyFunc(),
+		NetDialContext:    route.dialContext(),
+		HandshakeTimeout:  route.HandshakeTimeout,
+		EnableCompression: route.WSCompression && offersCompression(r.Header),
+		ReadBufferSize:    route.WSBufferSize,
+		WriteBufferSize:   route.WSBufferSize,
+	}
 
-			// Modify default Director function
-			originalDirector := proxy.Director
-			proxy.Director = func(req *http.Request) {
-				originalDirector(req)
+	// Establish WebSocket connection with target server, falling back to the next target on failure
+	var targetConn *websocket.Conn
+	var targetResp *http.Response
+	var dialErr error
+	targets := route.balancerFor(r)
+	for _, target := range targets.order() {
+		if !targets.tryAcquire(target) {
+			logger.Warnf("WebSocket target %s reached its connection limit", target)
+			continue
+		}
 
-				// Preserve original request path
-				req.URL.Path = r.URL.Path
-				if r.URL.RawQuery != "" {
-					req.URL.RawQuery = r.URL.RawQuery
-				}
+		// Log routing target
+		logger.Infof("Matched WebSocket route: %s -> %s", route.label(), target)
 
-				// Set X-Forwarded headers
-				req.Header.Set("X-Forwarded-Host", req.Host)
-				req.Header.Set("X-Forwarded-Proto", "http")
-				req.Header.Set("X-Forwarded-For", r.RemoteAddr)
+		// Build WebSocket URL
+		wsURL := fmt.Sprintf("ws://%s%s", target, rewritePath(r.URL.Path, route))
+		logger.Debugf("Attempting WebSocket connection: %s", wsURL)
 
-				// Log complete forwarding URL
-				log.Printf("%sForwarding request to: %s%s", ColorCyan, req.URL.String(), ColorReset)
+		conn, resp, err := dialer.Dial(wsURL, nil)
+		if err != nil {
+			if isTimeout(err) {
+				logger.Errorf("WebSocket handshake timed out after %s: %v", route.HandshakeTimeout, err)
+			} else {
+				logger.Errorf("WebSocket server connection failed: %v", err)
 			}
+			targets.release(target)
+			targets.markFailed(target)
+			dialErr = err
+			continue
+		}
+		defer targets.release(target)
+		targetConn = conn
+		targetResp = resp
+		break
+	}
+	if targetConn == nil && dialErr == nil {
+		logger.Errorf("All targets of WebSocket route %s reached their connection limit", route.label())
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if targetConn == nil {
+		route.errorPage.serve(w, proxyErrorStatus(dialErr))
+		return
+	}
+	defer targetConn.Close()
+	logger.Infof("WebSocket connection established successfully")
 
-			// Add error handling
-			proxy.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
-				log.Printf("%sProxy error: %v%s", ColorRed, err, ColorReset)
-				http.Error(rw, fmt.Sprintf("Proxy error: %v", err), http.StatusBadGateway)
-			}
+	// Upgrade client connection, negotiating compression only if the backend leg uses it
+	clientUpgrader := upgrader
+	clientUpgrader.CheckOrigin = func(r *http.Request) bool {
+		return originAllowed(r, route.AllowedOrigins)
+	}
+	clientUpgrader.EnableCompression = dialer.EnableCompression && offersCompression(targetResp.Header)
+	clientUpgrader.ReadBufferSize = route.WSBufferSize
+	clientUpgrader.WriteBufferSize = route.WSBufferSize
+	var responseHeader http.Header
+	if route.NameHeader {
+		responseHeader = http.Header{"X-Route-Name": {route.label()}}
+	}
+	clientConn, err := clientUpgrader.Upgrade(w, r, responseHeader)
+	if err != nil {
+		// The upgrader already responded to the client, tell the backend the connection is going away
+		logger.Errorf("WebSocket upgrade failed: %v", err)
+		message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "client upgrade failed")
+		_ = targetConn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+		return
+	}
+	defer clientConn.Close()
+	logger.Infof("Client WebSocket upgrade successful")
 
-			proxy.ServeHTTP(w, r)
-			return
-		}
+	activeBridges.Add(1)
+	defer activeBridges.Add(-1)
+
+	// Bridges of a route count as its requests, so reloads drain them like HTTP requests
+	route.drain.active.Add(1)
+	defer route.drain.active.Add(-1)
+
+	bridge := newWSBridge(clientConn, targetConn)
+	stopRetired := context.AfterFunc(route.drain.ctx, func() { bridge.cancel(errRouteRetired) })
+	defer stopRetired()
+	stopShutdown := context.AfterFunc(shutdown, func() { bridge.cancel(errShuttingDown) })
+	defer stopShutdown()
+
+	// Log the traffic forwarded in each direction and record the duration once the bridge closes
+	started := time.Now()
+	route.wsMetrics.opened()
+	defer func() {
+		duration := time.Since(started)
+		route.wsMetrics.closed(duration)
+		logger.Debugf("WebSocket closed after %s: client -> server %d messages (%d bytes), server -> client %d messages (%d bytes)",
+			duration.Round(time.Millisecond),
+			bridge.upstream.messages.Load(), bridge.upstream.bytes.Load(),
+			bridge.downstream.messages.Load(), bridge.downstream.bytes.Load())
+	}()
+
+	bridge.run(route.WSIdleTimeout)
+}
+
+// clientGone reports whether a proxy error was caused by the client cancelling the request or disconnecting
+func clientGone(r *http.Request, err error) bool {
+	if errors.Is(err, http.ErrAbortHandler) {
+		return true
+	}
+	return errors.Is(err, context.Canceled) && errors.Is(r.Context().Err(), context.Canceled)
+}
+
+// relayClose forwards the close code and reason received from one peer to the other peer
+func relayClose(conn *websocket.Conn, err error) {
+	closeErr, ok := err.(*websocket.CloseError)
+	if !ok || closeErr.Code == websocket.CloseAbnormalClosure {
+		return
 	}
 
-	log.Printf("%sNo matching route found: %s%s", ColorRed, r.URL.Path, ColorReset)
-	http.NotFound(w, r)
+	message := websocket.FormatCloseMessage(closeErr.Code, closeErr.Text)
+	if err := conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second)); err != nil {
+		logger.Errorf("Failed to relay close frame: %v", err)
+	}
 }
 
-func handleWebSocket(w http.ResponseWriter, r *http.Request, routes []RedirectConfig) {
-	log.Printf("%sReceived WebSocket request: %s%s", ColorYellow, r.URL.Path, ColorReset)
+// isTimeout reports whether the error was caused by a timeout
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
 
-	for _, route := range routes {
-		if strings.HasPrefix(r.URL.Path, route.Path) {
-			// Establish WebSocket connection with target server
-			host := route.Host
-			if len(host) == 0 {
-				host = "localhost"
-			}
+// sortRoutes orders the routes for matching: by descending priority, then by descending path length so the
+// longest matching prefix wins, then routes matching more headers first, then routes restricted to methods
+// before routes accepting all methods, and by config order otherwise
+func sortRoutes(routes []RedirectConfig) {
+	slices.SortStableFunc(routes, func(a, b RedirectConfig) int {
+		if a.Priority != b.Priority {
+			return cmp.Compare(b.Priority, a.Priority)
+		}
+		if len(a.Path) != len(b.Path) {
+			return cmp.Compare(len(b.Path), len(a.Path))
+		}
+		if len(a.MatchHeaders) != len(b.MatchHeaders) {
+			return cmp.Compare(len(b.MatchHeaders), len(a.MatchHeaders))
+		}
+		switch aAll, bAll := len(a.Methods) == 0, len(b.Methods) == 0; {
+		case aAll == bAll:
+			return 0
+		case aAll:
+			return 1
+		default:
+			return -1
+		}
+	})
+}
 
-			// Log routing target
-			log.Printf("%sMatched WebSocket route: %s -> %s:%d%s", ColorGreen, route.Path, host, route.Port, ColorReset)
+// clientIP returns the IP address of the client without the port, resolved through trusted proxies when configured
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
 
-			// Build WebSocket URL
-			wsURL := fmt.Sprintf("ws://%s:%d%s", host, route.Port, r.URL.Path)
-			log.Printf("%sAttempting WebSocket connection: %s%s", ColorCyan, wsURL, ColorReset)
+// remoteIP returns the IP address of the peer connected to the router without the port
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return strings.Trim(r.RemoteAddr, "[]")
+	}
+	return host
+}
 
-			targetConn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
-			if err != nil {
-				log.Printf("%sWebSocket server connection failed: %v%s", ColorRed, err, ColorReset)
-				http.Error(w, "Failed to connect to target server", http.StatusInternalServerError)
-				return
-			}
-			defer targetConn.Close()
-			log.Printf("%sWebSocket connection established successfully%s", ColorGreen, ColorReset)
-
-			// Upgrade client connection
-			clientConn, err := upgrader.Upgrade(w, r, nil)
-			if err != nil {
-				log.Printf("%sWebSocket upgrade failed: %v%s", ColorRed, err, ColorReset)
-				http.Error(w, "Failed to upgrade WebSocket connection", http.StatusInternalServerError)
-				return
-			}
-			defer clientConn.Close()
-			log.Printf("%sClient WebSocket upgrade successful%s", ColorGreen, ColorReset)
-
-			// Forward messages
-			go func() {
-				for {
-					messageType, message, err := clientConn.ReadMessage()
-					if err != nil {
-						log.Printf("%sRead from client failed: %v%s", ColorRed, err, ColorReset)
-						break
-					}
-					if err := targetConn.WriteMessage(messageType, message); err != nil {
-						log.Printf("%sWrite to server failed: %v%s", ColorRed, err, ColorReset)
-						break
-					}
-				}
-			}()
+// copyHeaders copies the values of the named headers from src to dst
+func copyHeaders(dst, src http.Header, names ...string) {
+	for _, name := range names {
+		if values := src.Values(name); len(values) != 0 {
+			dst[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+		}
+	}
+}
 
-			for {
-				messageType, message, err := targetConn.ReadMessage()
-				if err != nil {
-					log.Printf("%sRead from server failed: %v%s", ColorRed, err, ColorReset)
-					break
-				}
-				if err := clientConn.WriteMessage(messageType, message); err != nil {
-					log.Printf("%sWrite to client failed: %v%s", ColorRed, err, ColorReset)
-					break
-				}
+// boolValue returns the value of an optional config flag, or fallback when it is unset
+func boolValue(b *bool, fallback bool) bool {
+	if b == nil {
+		return fallback
+	}
+	return *b
+}
+
+// offersCompression reports whether the handshake headers negotiate the permessage-deflate extension
+func offersCompression(header http.Header) bool {
+	for _, value := range header.Values("Sec-WebSocket-Extensions") {
+		for _, extension := range strings.Split(value, ",") {
+			name, _, _ := strings.Cut(extension, ";")
+			if strings.EqualFold(strings.TrimSpace(name), "permessage-deflate") {
+				return true
 			}
-			return
 		}
 	}
-
-	log.Printf("%sNo matching WebSocket route found: %s%s", ColorRed, r.URL.Path, ColorReset)
-	http.NotFound(w, r)
+	return false
 }
@@ -0,0 +1,40 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// MaintenanceConfig describes the response served instead of proxying during planned downtime
+type MaintenanceConfig struct {
+	Enabled     bool   `mapstructure:"enabled"`
+	Status      int    `mapstructure:"status"`       // Defaults to 503 Service Unavailable
+	Body        string `mapstructure:"body"`         // Defaults to the status text
+	ContentType string `mapstructure:"content_type"` // Defaults to text/plain
+	RetryAfter  string `mapstructure:"retry_after"`  // Seconds or HTTP date sent in the Retry-After header
+}
+
+// serve writes the maintenance response
+func (m MaintenanceConfig) serve(w http.ResponseWriter) {
+	status := m.Status
+	if status == 0 {
+		status = http.StatusServiceUnavailable
+	}
+
+	body := m.Body
+	if len(body) == 0 {
+		body = fmt.Sprintf("%d %s\n", status, http.StatusText(status))
+	}
+
+	contentType := m.ContentType
+	if len(contentType) == 0 {
+		contentType = "text/plain; charset=utf-8"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if len(m.RetryAfter) != 0 {
+		w.Header().Set("Retry-After", m.RetryAfter)
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(body))
+}
@@ -0,0 +1,148 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Path of the Prometheus metrics endpoint of servers with metrics enabled
+const metricsPath = "/metrics"
+
+// Upper bounds in seconds of the WebSocket connection duration histogram buckets
+var wsDurationBuckets = []float64{1, 5, 15, 60, 300, 900, 3600, 14400}
+
+// metricsRegistry holds the metrics of all routes exposed on the metrics endpoint
+var metricsRegistry struct {
+	mu     sync.Mutex
+	ws     []*wsMetrics
+	routes []*routeMetrics
+}
+
+// routeMetrics records the proxied HTTP requests of a route
+type routeMetrics struct {
+	server string
+	route  string
+
+	slow atomic.Uint64 // Requests that took longer than the route's slow_threshold
+}
+
+// newRouteMetrics returns the HTTP metrics of a route, registering them unless a reload already did
+func newRouteMetrics(server, route string) *routeMetrics {
+	metricsRegistry.mu.Lock()
+	defer metricsRegistry.mu.Unlock()
+	for _, m := range metricsRegistry.routes {
+		if m.server == server && m.route == route {
+			return m
+		}
+	}
+
+	m := &routeMetrics{server: server, route: route}
+	metricsRegistry.routes = append(metricsRegistry.routes, m)
+	return m
+}
+
+// wsMetrics records the WebSocket bridges of a route
+type wsMetrics struct {
+	server string
+	route  string
+
+	open     atomic.Int64
+	buckets  []atomic.Uint64 // Closed bridges per duration bucket, not cumulative
+	count    atomic.Uint64
+	sumNanos atomic.Int64
+}
+
+// newWSMetrics returns the WebSocket metrics of a route, registering them unless a reload already did
+func newWSMetrics(server, route string) *wsMetrics {
+	metricsRegistry.mu.Lock()
+	defer metricsRegistry.mu.Unlock()
+	for _, m := range metricsRegistry.ws {
+		if m.server == server && m.route == route {
+			return m
+		}
+	}
+
+	m := &wsMetrics{server: server, route: route, buckets: make([]atomic.Uint64, len(wsDurationBuckets))}
+	metricsRegistry.ws = append(metricsRegistry.ws, m)
+	return m
+}
+
+// opened records a bridge that started forwarding messages
+func (m *wsMetrics) opened() {
+	m.open.Add(1)
+}
+
+// closed records a bridge that stopped after the duration
+func (m *wsMetrics) closed(duration time.Duration) {
+	m.open.Add(-1)
+	seconds := duration.Seconds()
+	for i, bound := range wsDurationBuckets {
+		if seconds <= bound {
+			m.buckets[i].Add(1)
+			break
+		}
+	}
+	m.count.Add(1)
+	m.sumNanos.Add(int64(duration))
+}
+
+// labelEscaper escapes label values of the Prometheus text format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels formats the server and route labels followed by the extra label pairs
+func (m *wsMetrics) labels(extra string) string {
+	return metricLabels(m.server, m.route, extra)
+}
+
+// metricLabels formats the server and route labels followed by the extra label pairs
+func metricLabels(server, route, extra string) string {
+	labels := fmt.Sprintf(`server="%s",route="%s"`, labelEscaper.Replace(server), labelEscaper.Replace(route))
+	if len(extra) != 0 {
+		labels += "," + extra
+	}
+	return "{" + labels + "}"
+}
+
+// metricsHandler serves the metrics in the Prometheus text exposition format
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	metricsRegistry.mu.Lock()
+	ws := append([]*wsMetrics(nil), metricsRegistry.ws...)
+	routes := append([]*routeMetrics(nil), metricsRegistry.routes...)
+	metricsRegistry.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("# HELP router_websocket_connections WebSocket bridges currently open.\n")
+	b.WriteString("# TYPE router_websocket_connections gauge\n")
+	for _, m := range ws {
+		fmt.Fprintf(&b, "router_websocket_connections%s %d\n", m.labels(""), m.open.Load())
+	}
+
+	b.WriteString("# HELP router_websocket_connection_duration_seconds Duration of closed WebSocket bridges.\n")
+	b.WriteString("# TYPE router_websocket_connection_duration_seconds histogram\n")
+	for _, m := range ws {
+		var cumulative uint64
+		for i, bound := range wsDurationBuckets {
+			cumulative += m.buckets[i].Load()
+			le := `le="` + strconv.FormatFloat(bound, 'g', -1, 64) + `"`
+			fmt.Fprintf(&b, "router_websocket_connection_duration_seconds_bucket%s %d\n", m.labels(le), cumulative)
+		}
+		count := m.count.Load()
+		fmt.Fprintf(&b, "router_websocket_connection_duration_seconds_bucket%s %d\n", m.labels(`le="+Inf"`), count)
+		fmt.Fprintf(&b, "router_websocket_connection_duration_seconds_sum%s %g\n", m.labels(""), time.Duration(m.sumNanos.Load()).Seconds())
+		fmt.Fprintf(&b, "router_websocket_connection_duration_seconds_count%s %d\n", m.labels(""), count)
+	}
+
+	b.WriteString("# HELP router_slow_requests_total Proxied requests slower than the slow_threshold of their route.\n")
+	b.WriteString("# TYPE router_slow_requests_total counter\n")
+	for _, m := range routes {
+		fmt.Fprintf(&b, "router_slow_requests_total%s %d\n", metricLabels(m.server, m.route, ""), m.slow.Load())
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write([]byte(b.String()))
+}
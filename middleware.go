@@ -0,0 +1,311 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// middleware wraps a handler with one feature of a route
+type middleware func(http.Handler) http.Handler
+
+// chain wraps the handler with the middlewares, the first middleware handles requests first
+func chain(handler http.Handler, middlewares ...middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// verboseKey marks requests that are access logged in their context
+type verboseKey struct{}
+
+// isVerbose reports whether the request is access logged
+func isVerbose(r *http.Request) bool {
+	verbose, _ := r.Context().Value(verboseKey{}).(bool)
+	return verbose
+}
+
+// newRouteHandler builds the handler serving the requests of the route: the middlewares enabled by the
+// route config, in the order they apply, in front of the static file server or the reverse proxy
+func newRouteHandler(route RedirectConfig) http.Handler {
+	middlewares := []middleware{trackRoute(route), accessLog(route)}
+	if route.NameHeader {
+		middlewares = append(middlewares, nameHeader(route))
+	}
+	if len(route.Methods) != 0 {
+		middlewares = append(middlewares, allowMethods(route))
+	}
+	if len(route.AllowedContentTypes) != 0 {
+		middlewares = append(middlewares, allowContentTypes(route))
+	}
+	if route.Maintenance.Enabled {
+		middlewares = append(middlewares, maintenance(route))
+	}
+	if route.static != nil {
+		return chain(route.static, append(middlewares, logStatic(route))...)
+	}
+
+	if route.Idempotency.Enabled {
+		middlewares = append(middlewares, idempotency(route))
+	}
+	if route.cache != nil {
+		middlewares = append(middlewares, serveCached(route))
+	}
+	if route.Coalesce {
+		middlewares = append(middlewares, coalesce(route))
+	}
+	if route.DecompressRequest.Enabled {
+		middlewares = append(middlewares, decompressRequestBody(route))
+	}
+	if len(route.Transform.Request) != 0 {
+		middlewares = append(middlewares, transformRequestBody(route))
+	}
+	if route.LogBodies.Enabled {
+		middlewares = append(middlewares, logBodies(route, newBodyRedactor(route.LogBodies.RedactFields)))
+	}
+	if route.BufferRequestBody.Enabled {
+		middlewares = append(middlewares, bufferRequestBody(route))
+	}
+	if route.Mirror != nil {
+		middlewares = append(middlewares, mirror(route))
+	}
+	if route.RequestTimeout > 0 {
+		middlewares = append(middlewares, requestTimeout(route))
+	}
+	if route.SlowThreshold > 0 {
+		middlewares = append(middlewares, logSlow(route))
+	}
+	return chain(newProxyHandler(route), middlewares...)
+}
+
+// accessLog decides whether the request is logged, access logging may be disabled or sampled per route
+func accessLog(route RedirectConfig) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			verbose := route.shouldLog()
+			r = r.WithContext(context.WithValue(r.Context(), verboseKey{}, verbose))
+			if !verbose {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			logger.Infof("Received request: %s", r.URL.Path)
+			started := time.Now()
+			recorder := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(recorder, r)
+			logAccess(r.Method, r.URL.Path, route.label(), recorder.status, time.Since(started))
+		})
+	}
+}
+
+// statusWriter records the status of the response passed through to the client, 0 while nothing was written
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 && status >= http.StatusOK {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(p []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(p)
+}
+
+// Flush forwards flushes of streamed responses
+func (sw *statusWriter) Flush() {
+	_ = http.NewResponseController(sw.ResponseWriter).Flush()
+}
+
+// Unwrap lets the proxy reach the connection of the client, e.g. to hijack it for protocol upgrades
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// nameHeader identifies the route to the client
+func nameHeader(route RedirectConfig) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Route-Name", route.label())
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// allowMethods rejects methods the route does not accept
+func allowMethods(route RedirectConfig) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !route.allowsMethod(r.Method) {
+				logger.Errorf("Method %s not allowed on route: %s", r.Method, route.label())
+				methodNotAllowed(w, route)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// methodNotAllowed answers with 405, listing the methods the route accepts
+func methodNotAllowed(w http.ResponseWriter, route RedirectConfig) {
+	w.Header().Set("Allow", strings.ToUpper(strings.Join(route.Methods, ", ")))
+	http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+}
+
+// bufferRequestBody buffers the request body so retries can send it again
+func bufferRequestBody(route RedirectConfig) middleware {
+	limit := route.BufferRequestBody.limit(route)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := bufferBody(r, limit); err != nil {
+				logger.Errorf("Failed to read request body on route %s: %v", route.label(), err)
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// allowContentTypes rejects request bodies whose content type the route does not accept, requests
+// without a body are not checked
+func allowContentTypes(route RedirectConfig) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hasBody := r.Method != http.MethodGet && r.Method != http.MethodHead && r.ContentLength != 0
+			if contentType := r.Header.Get("Content-Type"); hasBody && !matchesContentType(contentType, route.AllowedContentTypes) {
+				logger.Errorf("Content type %q not allowed on route: %s", contentType, route.label())
+				http.Error(w, "Unsupported Media Type", http.StatusUnsupportedMediaType)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// maintenance serves the maintenance response of the route instead of the request
+func maintenance(route RedirectConfig) middleware {
+	return func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logger.Warnf("Route under maintenance: %s", route.label())
+			route.Maintenance.serve(w)
+		})
+	}
+}
+
+// logStatic logs requests served from the static directory of the route
+func logStatic(route RedirectConfig) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isVerbose(r) {
+				logger.Infof("Matched static route: %s -> %s", route.label(), route.StaticDir)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// serveCached serves cached responses without contacting the backend, the proxy stores the responses of misses
+func serveCached(route RedirectConfig) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if key, ok := cacheKey(r); ok {
+				if entry, ok := route.cache.get(key); ok {
+					if isVerbose(r) {
+						logger.Debugf("Cache hit: %s (status %d, ttl %s)", logRedactor.URL(r.URL), entry.status, entry.ttl)
+					}
+					entry.serve(w)
+					return
+				}
+				if isVerbose(r) {
+					logger.Debugf("Cache miss: %s", logRedactor.URL(r.URL))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// decompressRequestBody decodes compressed request bodies, rejecting malformed ones and those decoding
+// to more than the limit
+func decompressRequestBody(route RedirectConfig) middleware {
+	limit := route.DecompressRequest.limit()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := decompressRequest(r, limit); err != nil {
+				logger.Errorf("Failed to decompress request body on route %s: %v", route.label(), err)
+				if errors.Is(err, errDecompressedTooLarge) {
+					http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+					return
+				}
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// transformRequestBody rewrites the request body through the route's external command
+func transformRequestBody(route RedirectConfig) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := route.Transform.transformRequest(r); err != nil {
+				logger.Errorf("Request transform of route %s failed: %v", route.label(), err)
+				status := http.StatusBadGateway
+				if errors.Is(err, errTransformTooLarge) {
+					status = http.StatusRequestEntityTooLarge
+				}
+				route.errorPage.serve(w, status)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// mirror shadows the request to the mirror backend without waiting for it
+func mirror(route RedirectConfig) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mirrorRequest(r, route)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// logSlow warns about proxied requests that took longer than the route's slow threshold, including the
+// time spent streaming the response
+func logSlow(route RedirectConfig) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			next.ServeHTTP(w, r)
+			if elapsed := time.Since(start); elapsed > route.SlowThreshold {
+				route.metrics.slow.Add(1)
+				logger.Warnf("Slow request on route %s: %s %s took %s, threshold %s",
+					route.label(), r.Method, logRedactor.URL(r.URL), elapsed.Round(time.Millisecond), route.SlowThreshold)
+			}
+		})
+	}
+}
+
+// requestTimeout cancels the upstream request once the route deadline passes, reported as 504 by the proxy
+func requestTimeout(route RedirectConfig) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), route.RequestTimeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
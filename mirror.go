@@ -0,0 +1,90 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// defaultMirrorTimeout bounds mirrored requests of routes without a request_timeout
+const defaultMirrorTimeout = 30 * time.Second
+
+// mirrorClient sends shadow requests, redirects are returned as is like the reverse proxy does
+var mirrorClient = &http.Client{
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// mirrorRequest sends a copy of the request to the route's mirror target in the background.
+// The body is buffered so both the primary and the mirror can read it, requests with bodies
+// above the route's buffer limit are not mirrored.
+func mirrorRequest(r *http.Request, route RedirectConfig) {
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		limit := route.bufferLimit()
+		buf, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+		// The primary still receives the complete body, whatever was read is put back in front of the rest
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+		if err != nil {
+			logger.Errorf("Mirror skipped, failed to read request body: %v", err)
+			return
+		}
+		if int64(len(buf)) > limit {
+			logger.Warnf("Mirror skipped, request body exceeds %d bytes: %s", limit, logRedactor.URL(r.URL))
+			return
+		}
+		body = buf
+	}
+
+	timeout := route.RequestTimeout
+	if timeout <= 0 {
+		timeout = defaultMirrorTimeout
+	}
+	// The mirror outlives the client request, it must not be cancelled when the primary response completes
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), timeout)
+
+	out := r.Clone(ctx)
+	out.RequestURI = ""
+	out.URL.Scheme = "http"
+	out.URL.Host = route.Mirror.String()
+	out.URL.Path = rewritePath(r.URL.Path, route)
+	out.URL.RawPath = ""
+	if !boolValue(route.PreserveHost, true) {
+		out.Host = out.URL.Host
+	}
+	out.Header.Del("Connection")
+	out.Header.Del("Upgrade")
+	out.Body = http.NoBody
+	out.ContentLength = int64(len(body))
+	if body != nil {
+		out.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if boolValue(route.ForwardedHeaders, true) && boolValue(route.XForwardedFor, true) {
+		out.Header.Set("X-Forwarded-For", clientIP(r))
+	}
+	if _, ok := out.Header["User-Agent"]; !ok {
+		// Like the reverse proxy, do not send the default Go HTTP client User-Agent
+		out.Header.Set("User-Agent", "")
+	}
+	route.applyUserAgent(out.Header)
+
+	go func() {
+		defer cancel()
+		resp, err := mirrorClient.Do(out)
+		if err != nil {
+			logger.Errorf("Mirror request of route %s to %s failed: %v", route.label(), route.Mirror, err)
+			return
+		}
+		defer resp.Body.Close()
+		_, _ = io.Copy(io.Discard, resp.Body)
+		if resp.StatusCode >= http.StatusInternalServerError {
+			logger.Warnf("Mirror %s responded %d: %s", route.Mirror, resp.StatusCode, logRedactor.URL(out.URL))
+		}
+	}()
+}
@@ -0,0 +1,70 @@
+package router
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// NotFoundConfig describes the response served for requests that match no route of a server
+type NotFoundConfig struct {
+	Status      int    `mapstructure:"status"`       // Defaults to 404 Not Found
+	Body        string `mapstructure:"body"`         // Defaults to the standard 404 page
+	File        string `mapstructure:"file"`         // File whose content is the body, overrides body
+	ContentType string `mapstructure:"content_type"` // Defaults to text/plain, or the type of file
+
+	content []byte
+}
+
+// enabled reports whether the server replaces the standard 404 page
+func (n NotFoundConfig) enabled() bool {
+	return n.Status != 0 || len(n.Body) != 0 || len(n.File) != 0
+}
+
+// load reads the body file so a missing file fails at startup rather than on the first unmatched request
+func (n *NotFoundConfig) load() error {
+	if len(n.File) == 0 {
+		n.content = []byte(n.Body)
+		return nil
+	}
+
+	content, err := os.ReadFile(n.File)
+	if err != nil {
+		return fmt.Errorf("read not_found file: %w", err)
+	}
+	n.content = content
+	if len(n.ContentType) == 0 {
+		n.ContentType = mime.TypeByExtension(filepath.Ext(n.File))
+	}
+	return nil
+}
+
+// serve writes the not found response, falling back to the standard 404 page when not configured
+func (n NotFoundConfig) serve(w http.ResponseWriter, r *http.Request) {
+	if !n.enabled() {
+		http.NotFound(w, r)
+		return
+	}
+
+	status := n.Status
+	if status == 0 {
+		status = http.StatusNotFound
+	}
+
+	body := n.content
+	if len(body) == 0 {
+		body = []byte(fmt.Sprintf("%d %s\n", status, http.StatusText(status)))
+	}
+
+	contentType := n.ContentType
+	if len(contentType) == 0 {
+		contentType = "text/plain; charset=utf-8"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
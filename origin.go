@@ -0,0 +1,49 @@
+package router
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// originAllowed reports whether the Origin header of the WebSocket request matches the allowed origins.
+// Entries are full origins ("https://app.example.com"), host names ("app.example.com"), wildcard
+// subdomains ("*.example.com", "https://*.example.com") or "*" to allow any origin. Without entries
+// only requests from the same host as the router, or without an Origin header, are allowed.
+func originAllowed(r *http.Request, allowed []string) bool {
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if len(allowed) == 0 {
+		return strings.EqualFold(u.Host, r.Host)
+	}
+
+	for _, pattern := range allowed {
+		if pattern == "*" || matchOrigin(u, strings.ToLower(pattern)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOrigin reports whether the origin matches a single allowed origin pattern
+func matchOrigin(origin *url.URL, pattern string) bool {
+	host := strings.ToLower(origin.Host)
+	if scheme, rest, ok := strings.Cut(pattern, "://"); ok {
+		if !strings.EqualFold(scheme, origin.Scheme) {
+			return false
+		}
+		pattern = rest
+	}
+
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
@@ -0,0 +1,54 @@
+package router
+
+import (
+	"strings"
+)
+
+// Trailing slash policies applied to forwarded paths
+const (
+	TrailingSlashPreserve = "preserve"
+	TrailingSlashStrip    = "strip"
+	TrailingSlashAdd      = "add"
+)
+
+// applyTrailingSlash normalizes the trailing slash of the path according to the policy, the root path is kept as is
+func applyTrailingSlash(path, policy string) string {
+	if path == "/" || len(path) == 0 {
+		return path
+	}
+
+	switch policy {
+	case TrailingSlashStrip:
+		trimmed := strings.TrimRight(path, "/")
+		if len(trimmed) == 0 {
+			return "/"
+		}
+		return trimmed
+	case TrailingSlashAdd:
+		if !strings.HasSuffix(path, "/") {
+			return path + "/"
+		}
+	}
+	return path
+}
+
+// rewritePath returns the path forwarded to the backend: the route prefix is stripped, the target prefix
+// prepended and the trailing slash normalized according to the route config
+func rewritePath(path string, route RedirectConfig) string {
+	if route.StripPrefix {
+		path = strings.TrimPrefix(path, strings.TrimSuffix(route.Path, "/"))
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+	}
+	// A target prefix of only slashes mounts nothing
+	if trimmed := strings.Trim(route.TargetPrefix, "/"); len(trimmed) != 0 {
+		prefix := "/" + trimmed
+		if path == "/" {
+			path = prefix + "/"
+		} else {
+			path = prefix + path
+		}
+	}
+	return applyTrailingSlash(path, route.TrailingSlash)
+}
@@ -0,0 +1,37 @@
+package router
+
+import "testing"
+
+func TestRewritePath(t *testing.T) {
+	tests := []struct {
+		name  string
+		path  string
+		route RedirectConfig
+		want  string
+	}{
+		{"unchanged", "/api/users/", RedirectConfig{Path: "/api"}, "/api/users/"},
+		{"strip", "/api/users", RedirectConfig{Path: "/api", StripPrefix: true}, "/users"},
+		{"strip route with trailing slash", "/api/users", RedirectConfig{Path: "/api/", StripPrefix: true}, "/users"},
+		{"strip to empty remainder", "/api", RedirectConfig{Path: "/api", StripPrefix: true}, "/"},
+		{"strip to root", "/api/", RedirectConfig{Path: "/api/", StripPrefix: true}, "/"},
+		{"target", "/users", RedirectConfig{Path: "/", TargetPrefix: "/service-a"}, "/service-a/users"},
+		{"target at root", "/", RedirectConfig{Path: "/", TargetPrefix: "/service-a"}, "/service-a/"},
+		{"target with trailing slash", "/users", RedirectConfig{Path: "/", TargetPrefix: "/service-a/"}, "/service-a/users"},
+		{"target without leading slash", "/users", RedirectConfig{Path: "/", TargetPrefix: "service-a"}, "/service-a/users"},
+		{"target of only slashes", "/users", RedirectConfig{Path: "/", TargetPrefix: "/"}, "/users"},
+		{"strip and target", "/api/users", RedirectConfig{Path: "/api", StripPrefix: true, TargetPrefix: "/service-a"}, "/service-a/users"},
+		{"strip and nested target", "/api/users/1", RedirectConfig{Path: "/api/", StripPrefix: true, TargetPrefix: "/v2/service-a/"}, "/v2/service-a/users/1"},
+		{"strip and target with empty remainder", "/api", RedirectConfig{Path: "/api", StripPrefix: true, TargetPrefix: "/service-a"}, "/service-a/"},
+		{"strip and target keeping trailing slash", "/api/users/", RedirectConfig{Path: "/api", StripPrefix: true, TargetPrefix: "/service-a"}, "/service-a/users/"},
+		{"strip and target removing trailing slash", "/api", RedirectConfig{Path: "/api", StripPrefix: true, TargetPrefix: "/service-a", TrailingSlash: TrailingSlashStrip}, "/service-a"},
+		{"strip and target adding trailing slash", "/api/users", RedirectConfig{Path: "/api", StripPrefix: true, TargetPrefix: "/service-a", TrailingSlash: TrailingSlashAdd}, "/service-a/users/"},
+		{"strip to root removing trailing slash", "/api/", RedirectConfig{Path: "/api", StripPrefix: true, TrailingSlash: TrailingSlashStrip}, "/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rewritePath(tt.path, tt.route); got != tt.want {
+				t.Errorf("rewritePath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// expandPorts replaces every server block listing ports with one block per port, each serving the same
+// routes and settings. TLS only applies to the ports listed in tls.ports when set, and redirect_to_https only
+// to the other ports.
+func expandPorts(servers []ServerConfig) ([]ServerConfig, error) {
+	expanded := make([]ServerConfig, 0, len(servers))
+	for _, server := range servers {
+		if len(server.Ports) == 0 {
+			expanded = append(expanded, server)
+			continue
+		}
+		if server.Server != 0 || len(server.PortRange) != 0 {
+			return nil, fmt.Errorf("server block with ports %v also sets server or port_range", server.Ports)
+		}
+		for _, port := range server.TLS.Ports {
+			if !slices.Contains(server.Ports, port) {
+				return nil, fmt.Errorf("tls port %d is not one of the server ports %v", port, server.Ports)
+			}
+		}
+
+		for i, port := range server.Ports {
+			if port < 1 || port > 65535 {
+				return nil, fmt.Errorf("invalid port %d in ports %v", port, server.Ports)
+			}
+			if slices.Contains(server.Ports[:i], port) {
+				return nil, fmt.Errorf("duplicate port %d in ports %v", port, server.Ports)
+			}
+
+			alias := server
+			alias.Server = port
+			alias.Ports = nil
+			alias.Redirect = slices.Clone(server.Redirect)
+			if len(server.TLS.Ports) != 0 && !slices.Contains(server.TLS.Ports, port) {
+				alias.TLS = TLSConfig{}
+			}
+			// Only the plain HTTP ports redirect to HTTPS, the TLS ports serve the routes
+			if alias.TLS.enabled() {
+				alias.RedirectToHTTPS = HTTPSRedirectConfig{}
+			}
+			expanded = append(expanded, alias)
+		}
+	}
+	return expanded, nil
+}
+
+// portRange returns the first and last port of the server's port_range
+func (s ServerConfig) portRange() (int, int, error) {
+	first, last, ok := strings.Cut(s.PortRange, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid port_range %q, expected <first>-<last>", s.PortRange)
+	}
+	from, err := strconv.Atoi(strings.TrimSpace(first))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port_range %q: %w", s.PortRange, err)
+	}
+	to, err := strconv.Atoi(strings.TrimSpace(last))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port_range %q: %w", s.PortRange, err)
+	}
+	if from <= 0 || to > 65535 || from > to {
+		return 0, 0, fmt.Errorf("invalid port_range %q, ports must be ascending between 1 and 65535", s.PortRange)
+	}
+	return from, to, nil
+}
+
+// validatePort checks that the server sets either a port or a valid port range
+func (s ServerConfig) validatePort() error {
+	if len(s.PortRange) == 0 {
+		return nil
+	}
+	if s.Server != 0 {
+		return fmt.Errorf("server %d sets both server and port_range", s.Server)
+	}
+	_, _, err := s.portRange()
+	return err
+}
+
+// dynamicPort reports whether the port of the server is only known once it is bound
+func (s ServerConfig) dynamicPort() bool {
+	return s.Server == 0
+}
+
+// portLabel describes the configured port of the server in logs
+func (s ServerConfig) portLabel() string {
+	switch {
+	case len(s.PortRange) != 0:
+		return s.PortRange
+	case s.Server == 0:
+		return "auto"
+	}
+	return strconv.Itoa(s.Server)
+}
+
+// listen binds the port of the server. Servers with a port range bind the first free port of the range,
+// and servers with port 0 a port assigned by the OS.
+func (s ServerConfig) listen() (net.Listener, error) {
+	lc := s.listenConfig()
+	if len(s.PortRange) == 0 {
+		return lc.Listen(context.Background(), "tcp", fmt.Sprintf(":%d", s.Server))
+	}
+
+	from, to, err := s.portRange()
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for port := from; port <= to; port++ {
+		listener, err := lc.Listen(context.Background(), "tcp", fmt.Sprintf(":%d", port))
+		if err == nil {
+			return listener, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("no free port in range %s: %w", s.PortRange, errors.Join(errs...))
+}
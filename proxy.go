@@ -0,0 +1,272 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+)
+
+// requestScheme returns the scheme the client used to reach the router
+func requestScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// proxyRequestKey is the context key of the state of a request forwarded by the proxies of a route
+type proxyRequestKey struct{}
+
+// proxyRequest is the state of a forwarded request, read by the callbacks of the shared proxies from the
+// request context
+type proxyRequest struct {
+	in      *http.Request // Request as received by the proxy handler
+	verbose bool
+	targets *balancer
+	target  TargetConfig
+	retry   *retryTransport // Set when the route sends failed attempts again
+}
+
+// proxyRequestFrom returns the state of the forwarded request
+func proxyRequestFrom(ctx context.Context) *proxyRequest {
+	return ctx.Value(proxyRequestKey{}).(*proxyRequest)
+}
+
+// newProxyHandler returns the terminal handler of proxied routes, forwarding requests to a target of the route
+// through a reverse proxy built once per target
+func newProxyHandler(route RedirectConfig) http.Handler {
+	proxies := make(map[TargetConfig]*httputil.ReverseProxy)
+	for _, targets := range []*balancer{route.balancer, route.canary} {
+		if targets == nil {
+			continue
+		}
+		for _, target := range targets.targets {
+			proxy, err := newTargetProxy(route, target)
+			if err != nil {
+				logger.Errorf("Failed to parse target URL of route %s: %v", route.label(), err)
+				continue
+			}
+			proxies[target] = proxy
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verbose := isVerbose(r)
+
+		// Reserve a slot on a target with capacity left, failing over to the next target when one is full
+		// and queuing for a free slot when all are
+		targets := route.balancerFor(r)
+		target, ok := targets.acquire()
+		if !ok && route.queue != nil {
+			target, ok = route.queue.wait(r.Context(), targets)
+		}
+		if !ok {
+			logger.Errorf("All targets of route %s reached their connection limit", route.label())
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		defer targets.release(target)
+
+		// Log routing match
+		if verbose {
+			logger.Infof("Matched route: %s -> %s", route.label(), target)
+		}
+
+		proxy, ok := proxies[target]
+		if !ok {
+			http.Error(w, "Failed to parse target URL", http.StatusInternalServerError)
+			return
+		}
+
+		state := &proxyRequest{in: r, verbose: verbose, targets: targets, target: target}
+		// Send requests that failed to connect or were answered with a retryable status again to another target
+		if len(route.RetryOnStatus) != 0 || route.BufferRequestBody.Enabled {
+			state.retry = newRetryTransport(route, targets, target)
+			defer state.retry.release()
+		}
+
+		proxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), proxyRequestKey{}, state)))
+	})
+}
+
+// newTargetProxy returns the reverse proxy forwarding the requests of the route to the target
+func newTargetProxy(route RedirectConfig, target TargetConfig) (*httputil.ReverseProxy, error) {
+	targetURL, err := url.Parse(fmt.Sprintf("http://%s", target))
+	if err != nil {
+		return nil, err
+	}
+
+	var securityHeaders http.Header
+	if route.SecurityHeaders.Enabled {
+		securityHeaders = route.SecurityHeaders.headers()
+	}
+	var redactBody *bodyRedactor
+	if route.LogBodies.Enabled {
+		redactBody = newBodyRedactor(route.LogBodies.RedactFields)
+	}
+
+	// Create and configure reverse proxy
+	proxy := &httputil.ReverseProxy{
+		Transport:     route.transport,
+		FlushInterval: route.FlushInterval,
+		BufferPool:    proxyBufferPool,
+	}
+	if route.Protocol == ProtocolGRPC {
+		// gRPC streams must not be buffered, trailers are forwarded by the reverse proxy
+		proxy.FlushInterval = -1
+	}
+
+	// Attempts of routes retrying them go through the retry transport of their request
+	if len(route.RetryOnStatus) != 0 || route.BufferRequestBody.Enabled {
+		proxy.Transport = retryingTransport{}
+	}
+
+	proxy.Rewrite = func(pr *httputil.ProxyRequest) {
+		state := proxyRequestFrom(pr.In.Context())
+		r := state.in
+		pr.SetURL(targetURL)
+
+		// Forward original request path, rewritten according to the route
+		pr.Out.URL.Path = rewritePath(r.URL.Path, route)
+
+		// The client Host is kept unless the backend expects its own host name
+		if boolValue(route.PreserveHost, true) {
+			pr.Out.Host = pr.In.Host
+		}
+
+		// Set X-Forwarded headers, or pass the client's headers through untouched when disabled
+		copyHeaders(pr.Out.Header, pr.In.Header, "Forwarded")
+		if boolValue(route.ForwardedHeaders, true) {
+			pr.Out.Header.Set("X-Forwarded-Host", pr.In.Host)
+			pr.Out.Header.Set("X-Forwarded-Proto", requestScheme(r))
+			if boolValue(route.XForwardedFor, true) {
+				pr.Out.Header.Set("X-Forwarded-For", clientIP(r))
+			}
+		} else {
+			copyHeaders(pr.Out.Header, pr.In.Header, "X-Forwarded-For", "X-Forwarded-Host", "X-Forwarded-Proto")
+		}
+		if boolValue(route.XRealIP, true) {
+			pr.Out.Header.Set("X-Real-IP", clientIP(r))
+		}
+		if route.clientCertHeaders {
+			setClientCertHeaders(pr.Out.Header, r)
+		}
+		route.applyUserAgent(pr.Out.Header)
+		if route.ConnectionClose {
+			pr.Out.Close = true
+		}
+		if route.HeadAsGet && pr.In.Method == http.MethodHead {
+			pr.Out.Method = http.MethodGet
+		}
+		// Some backends only send trailers to clients declaring support for them
+		if route.Trailers {
+			pr.Out.Header.Set("Te", "trailers")
+		}
+
+		// Log complete forwarding URL
+		if state.verbose {
+			logger.Debugf("Forwarding request to: %s", logRedactor.URL(pr.Out.URL))
+		}
+	}
+
+	// Identify the router and harden responses, then cache and compress them at the edge when enabled for the route
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		state := proxyRequestFrom(resp.Request.Context())
+		r, verbose := state.in, state.verbose
+		if route.HeadAsGet && r.Method == http.MethodHead {
+			discardBody(resp)
+		}
+		if status, ok := route.StatusMap[resp.StatusCode]; ok {
+			remapStatus(resp, status)
+		}
+		if route.Decompress {
+			decompressResponse(resp, r)
+		}
+		if len(route.servedBy) != 0 {
+			resp.Header.Set("X-Served-By", route.servedBy)
+		}
+		if securityHeaders != nil {
+			route.SecurityHeaders.apply(resp.Header, securityHeaders)
+		}
+		if len(route.Transform.Response) != 0 {
+			if err := route.Transform.transformResponse(resp); err != nil {
+				return err
+			}
+		}
+		if redactBody != nil && verbose {
+			logger.Debugf("Response headers of %s %s (%d): %s", r.Method, logRedactor.URL(r.URL), resp.StatusCode, formatHeaders(resp.Header))
+			description := fmt.Sprintf("Response body of %s %s (%d)", r.Method, logRedactor.URL(r.URL), resp.StatusCode)
+			resp.Body = route.LogBodies.wrap(resp.Body, resp.Header, redactBody, description)
+		}
+		// Cached responses are replayed without the trailers the backend announced
+		if key, cacheable := cacheKey(r); cacheable && route.cache != nil && !(route.Trailers && len(resp.Trailer) != 0) {
+			if ttl := route.cache.capture(resp, key, route.bufferLimit()); ttl > 0 && verbose {
+				logger.Debugf("Cache store: %s (status %d, ttl %s)", logRedactor.URL(r.URL), resp.StatusCode, ttl)
+			}
+		}
+		compressResponse(resp, r, route.Compression, route.bufferLimit())
+		return nil
+	}
+
+	// Add error handling
+	proxy.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
+		state := proxyRequestFrom(req.Context())
+
+		// The route was reconfigured by a reload and did not finish within its drain timeout
+		if errors.Is(err, context.Canceled) && route.drain.cancelled() {
+			logger.Warnf("Request cancelled after route %s was reconfigured: %s", route.label(), logRedactor.URL(req.URL))
+			route.errorPage.serve(rw, http.StatusServiceUnavailable)
+			return
+		}
+
+		// A client that went away is not a backend failure, and there is no one left to respond to
+		if clientGone(req, err) {
+			if state.verbose {
+				logger.Warnf("Client disconnected: %s", logRedactor.URL(req.URL))
+			}
+			return
+		}
+
+		logger.Errorf("Proxy error: %v", err)
+		// Avoid the failing target so traffic fails over to the remaining ones, unless the transform failed
+		if !errors.Is(err, errTransform) {
+			state.targets.markFailed(state.target)
+		}
+		if route.Protocol == ProtocolGRPC && isGRPCRequest(req) {
+			writeGRPCUnavailable(rw, "upstream unavailable")
+			return
+		}
+		route.errorPage.serve(rw, proxyErrorStatus(err))
+	}
+
+	return proxy, nil
+}
+
+// retryingTransport sends the attempts of a request through its retry transport
+type retryingTransport struct{}
+
+func (retryingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return proxyRequestFrom(req.Context()).retry.RoundTrip(req)
+}
+
+// discardBody drops the body of a GET response answering a HEAD request, keeping its Content-Length header
+func discardBody(resp *http.Response) {
+	_ = resp.Body.Close()
+	resp.Body = http.NoBody
+}
+
+// remapStatus presents the response with another status, dropping the body when the status has none
+func remapStatus(resp *http.Response, status int) {
+	resp.StatusCode = status
+	resp.Status = fmt.Sprintf("%d %s", status, http.StatusText(status))
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		_ = resp.Body.Close()
+		resp.Body = http.NoBody
+		resp.ContentLength = 0
+		resp.Header.Del("Content-Length")
+		resp.Header.Del("Content-Type")
+	}
+}
@@ -0,0 +1,169 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newRouteServer serves the route on a test server, forwarding to the backend
+func newRouteServer(t testing.TB, backend *httptest.Server, route RedirectConfig) *httptest.Server {
+	t.Helper()
+
+	route.Path = "/"
+	route.Host = "127.0.0.1"
+	route.Port = backend.Listener.Addr().(*net.TCPAddr).Port
+	log := false
+	route.Log = &log
+	server := prepareServer(t, Config{Router: []ServerConfig{{Server: 8080, Redirect: []RedirectConfig{route}}}})
+	front := httptest.NewServer(server.Redirect[0].handler)
+	t.Cleanup(front.Close)
+	return front
+}
+
+func TestTrailers(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/announced":
+			w.Header().Set("Trailer", "X-Checksum")
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = io.WriteString(w, "body")
+			w.Header().Set("X-Checksum", "abc123")
+		case "/unannounced":
+			// Unannounced trailers need a chunked body, which flushing before the end forces
+			_, _ = io.WriteString(w, "body")
+			w.(http.Flusher).Flush()
+			w.Header().Set(http.TrailerPrefix+"X-Checksum", "abc123")
+		case "/te":
+			// Like backends that only send trailers to clients declaring support for them
+			if r.Header.Get("Te") == "trailers" {
+				w.Header().Set("Trailer", "X-Checksum")
+			}
+			_, _ = io.WriteString(w, "body")
+			if r.Header.Get("Te") == "trailers" {
+				w.Header().Set("X-Checksum", "abc123")
+			}
+		}
+	}))
+	defer backend.Close()
+
+	tests := []struct {
+		name   string
+		route  RedirectConfig
+		path   string
+		header http.Header
+	}{
+		{"announced", RedirectConfig{}, "/announced", nil},
+		{"unannounced", RedirectConfig{}, "/unannounced", nil},
+		{"requested by the route", RedirectConfig{Trailers: true}, "/te", nil},
+		{"compressed", RedirectConfig{Compression: CompressionConfig{Enabled: true}}, "/announced", http.Header{"Accept-Encoding": {"gzip"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			front := newRouteServer(t, backend, tt.route)
+
+			req, err := http.NewRequest(http.MethodGet, front.URL+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+			resp, err := http.DefaultTransport.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			// Trailers are only available once the body was read
+			if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+				t.Fatal(err)
+			}
+			if got := resp.Trailer.Get("X-Checksum"); got != "abc123" {
+				t.Errorf("got trailer X-Checksum %q, want %q", got, "abc123")
+			}
+		})
+	}
+}
+
+func BenchmarkProxy(b *testing.B) {
+	body := bytes.Repeat([]byte("x"), 64<<10)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(body)
+	}))
+	defer backend.Close()
+
+	log := false
+	server := prepareServer(b, Config{Router: []ServerConfig{{
+		Server: 8080,
+		Redirect: []RedirectConfig{{
+			Path: "/",
+			Host: "127.0.0.1",
+			Port: backend.Listener.Addr().(*net.TCPAddr).Port,
+			Log:  &log,
+		}},
+	}}})
+	route := server.Redirect[0]
+	target := route.balancer.targets[0]
+
+	run := func(b *testing.B, handler http.Handler) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rec := httptest.NewRecorder()
+			rec.Body = nil
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/bench", nil))
+			if rec.Code != http.StatusOK {
+				b.Fatalf("got status %d", rec.Code)
+			}
+		}
+	}
+
+	// The proxy handler of the route reuses a proxy per target and the pooled copy buffers
+	b.Run("shared", func(b *testing.B) {
+		run(b, newProxyHandler(route))
+	})
+
+	// A proxy built for every request, copying with a buffer of its own
+	b.Run("per_request", func(b *testing.B) {
+		run(b, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			proxy, err := newTargetProxy(route, target)
+			if err != nil {
+				b.Fatal(err)
+			}
+			proxy.BufferPool = nil
+			state := &proxyRequest{in: r, targets: route.balancer, target: target}
+			proxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), proxyRequestKey{}, state)))
+		}))
+	})
+}
+
+func TestServedByDynamicPort(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	servers, err := prepareServers(Config{Router: []ServerConfig{{
+		Server:   0,
+		ServedBy: true,
+		Redirect: []RedirectConfig{{Path: "/", Host: "127.0.0.1", Port: backend.Listener.Addr().(*net.TCPAddr).Port}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := servers[0]
+	server.buildRoutes("", 41234)
+
+	front := httptest.NewServer(server.Redirect[0].handler)
+	defer front.Close()
+	resp, err := http.Get(front.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if name := resp.Header.Get("X-Served-By"); name != "router:41234" {
+		t.Errorf("got X-Served-By %q, want the bound port %q", name, "router:41234")
+	}
+}
@@ -0,0 +1,50 @@
+package router
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Longest wait of a queued request for a target with capacity unless configured otherwise
+const defaultQueueTimeout = time.Second
+
+// QueueConfig lets requests wait briefly for a target with capacity left instead of failing at once when
+// every target of the route reached its max_conns
+type QueueConfig struct {
+	Size    int           `mapstructure:"size"`    // Requests waiting at once, further requests fail at once; disabled when zero
+	Timeout time.Duration `mapstructure:"timeout"` // Longest wait for a free connection slot, defaults to 1s
+}
+
+// requestQueue bounds the requests of a route waiting for a connection slot
+type requestQueue struct {
+	size    int64
+	timeout time.Duration
+	waiting atomic.Int64
+}
+
+// newRequestQueue creates the queue of the config, returning nil when queuing is disabled
+func newRequestQueue(cfg QueueConfig) *requestQueue {
+	if cfg.Size <= 0 {
+		return nil
+	}
+	q := &requestQueue{size: int64(cfg.Size), timeout: cfg.Timeout}
+	if q.timeout <= 0 {
+		q.timeout = defaultQueueTimeout
+	}
+	return q
+}
+
+// wait reserves a connection slot on a target of the balancer once one frees up, failing when the queue
+// is full, the timeout passes or the request is cancelled first
+func (q *requestQueue) wait(ctx context.Context, targets *balancer) (TargetConfig, bool) {
+	if q.waiting.Add(1) > q.size {
+		q.waiting.Add(-1)
+		return TargetConfig{}, false
+	}
+	defer q.waiting.Add(-1)
+
+	ctx, cancel := context.WithTimeout(ctx, q.timeout)
+	defer cancel()
+	return targets.acquireWait(ctx)
+}
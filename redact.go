@@ -0,0 +1,97 @@
+package router
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const redactedValue = "***"
+
+// Query parameters redacted from logs unless configured otherwise
+var defaultRedactQuery = []string{
+	"access_token",
+	"refresh_token",
+	"id_token",
+	"token",
+	"api_key",
+	"apikey",
+	"password",
+	"secret",
+	"client_secret",
+}
+
+// Headers redacted from logs unless configured otherwise
+var defaultRedactHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+}
+
+// redactor replaces sensitive values before they are written to logs
+type redactor struct {
+	query   map[string]struct{}
+	headers map[string]struct{}
+}
+
+// logRedactor is used by all log lines that include URLs or headers
+var logRedactor = newRedactor(nil, nil)
+
+// newRedactor creates a redactor for the given query parameter and header names, falling back to the defaults when empty
+func newRedactor(query, headers []string) *redactor {
+	if len(query) == 0 {
+		query = defaultRedactQuery
+	}
+	if len(headers) == 0 {
+		headers = defaultRedactHeaders
+	}
+
+	r := &redactor{
+		query:   make(map[string]struct{}, len(query)),
+		headers: make(map[string]struct{}, len(headers)),
+	}
+	for _, name := range query {
+		r.query[strings.ToLower(name)] = struct{}{}
+	}
+	for _, name := range headers {
+		r.headers[http.CanonicalHeaderKey(name)] = struct{}{}
+	}
+	return r
+}
+
+// URL returns the string form of u with sensitive query parameter values redacted
+func (r *redactor) URL(u *url.URL) string {
+	if len(u.RawQuery) == 0 {
+		return u.String()
+	}
+
+	pairs := strings.Split(u.RawQuery, "&")
+	for i, pair := range pairs {
+		key, _, _ := strings.Cut(pair, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		if _, ok := r.query[strings.ToLower(name)]; ok {
+			pairs[i] = key + "=" + redactedValue
+		}
+	}
+
+	redacted := *u
+	redacted.RawQuery = strings.Join(pairs, "&")
+	return redacted.String()
+}
+
+// Header returns a copy of h with sensitive header values redacted
+func (r *redactor) Header(h http.Header) http.Header {
+	redacted := h.Clone()
+	for name, values := range redacted {
+		if _, ok := r.headers[http.CanonicalHeaderKey(name)]; ok {
+			for i := range values {
+				values[i] = redactedValue
+			}
+		}
+	}
+	return redacted
+}
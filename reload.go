@@ -0,0 +1,77 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+)
+
+// liveServer holds the config of a running server, replaced when the config is reloaded
+type liveServer struct {
+	atomic.Pointer[ServerConfig]
+}
+
+// reloadConfig reads the config again and replaces the routes of the running servers. Requests in flight
+// keep being served by the replaced routes, which are drained in the background. Listener settings, and
+// servers added to or removed from the config, only take effect on restart.
+func reloadConfig(load func() (Config, error), live map[int]*liveServer) error {
+	config, err := load()
+	if err != nil {
+		logger.Errorf("Failed to reload config, keeping the current one: %v", err)
+		return err
+	}
+	config.expandEnv()
+
+	servers, err := prepareServers(config)
+	if err != nil {
+		logger.Errorf("Invalid config, keeping the current one: %v", err)
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	logStartupSummary(config, servers)
+
+	reloaded := make(map[int]bool, len(servers))
+	for _, server := range servers {
+		if !server.IsEnabled() || server.dynamicPort() {
+			continue
+		}
+		current, ok := live[server.Server]
+		if !ok {
+			logger.Warnf("Server on port %d was added, restart the router to start it", server.Server)
+			continue
+		}
+
+		old := current.Swap(&server)
+		reloaded[server.Server] = true
+		go drainRoutes(old.Redirect, server.Redirect)
+	}
+	for port := range live {
+		if !reloaded[port] {
+			logger.Warnf("Server on port %d was removed or disabled, restart the router to stop it", port)
+		}
+	}
+	return nil
+}
+
+// drainRoutes retires the routes replaced by a reload. Requests to routes whose config is unchanged are left
+// to finish, requests to reconfigured or removed routes are cancelled once the route's drain timeout passes.
+func drainRoutes(old, replacements []RedirectConfig) {
+	configs := make(map[string][]byte, len(replacements))
+	for _, route := range replacements {
+		configs[route.matchKey()] = routeFingerprint(route)
+	}
+
+	for _, route := range old {
+		next, ok := configs[route.matchKey()]
+		changed := !ok || string(next) != string(routeFingerprint(route))
+		go route.drain.retire(route, changed)
+	}
+}
+
+// routeFingerprint returns the serialized config of the route, equal for routes with the same config
+func routeFingerprint(route RedirectConfig) []byte {
+	data, err := json.Marshal(route)
+	if err != nil {
+		return nil
+	}
+	return data
+}
@@ -0,0 +1,168 @@
+package router
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Defaults of status retries when not configured
+const (
+	defaultRetryAttempts = 2
+	defaultRetryBackoff  = 100 * time.Millisecond
+	defaultRetryMaxTime  = 5 * time.Second
+)
+
+// BufferBodyConfig buffers request bodies up front so requests with a body can be sent again by retries
+type BufferBodyConfig struct {
+	Enabled bool  `mapstructure:"enabled"`
+	MaxSize int64 `mapstructure:"max_size"` // Largest body buffered in bytes, defaults to the route's max_buffer_size
+}
+
+// limit returns the largest body buffered for the route
+func (c BufferBodyConfig) limit(route RedirectConfig) int64 {
+	if c.MaxSize <= 0 {
+		return route.bufferLimit()
+	}
+	return c.MaxSize
+}
+
+// bufferBody reads the request body into memory and lets retries replay it through GetBody. Bodies above
+// the limit are streamed as usual and their requests are not retried.
+func bufferBody(r *http.Request, limit int64) error {
+	if r.Body == nil || r.Body == http.NoBody || r.GetBody != nil {
+		return nil
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(buf)) > limit {
+		// Put what was read back in front of the rest so the backend still receives the complete body
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+		return nil
+	}
+
+	_ = r.Body.Close()
+	r.ContentLength = int64(len(buf))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf)), nil
+	}
+	r.Body, _ = r.GetBody()
+	return nil
+}
+
+// retryableMethod reports whether requests of the method may be sent again without side effects
+func retryableMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// retryTransport sends requests again to another target when the connection to the backend fails or the
+// backend responds with a retryable status, waiting an exponentially growing backoff between attempts.
+// The last response or error is returned once the attempts or the total retry time are used up.
+type retryTransport struct {
+	next    http.RoundTripper
+	route   RedirectConfig
+	targets *balancer
+
+	current  TargetConfig   // Target of the latest attempt
+	acquired []TargetConfig // Targets reserved for retries, freed by release
+}
+
+// newRetryTransport wraps the transport of the route, the first attempt goes to the already reserved target
+func newRetryTransport(route RedirectConfig, targets *balancer, target TargetConfig) *retryTransport {
+	next := route.transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &retryTransport{next: next, route: route, targets: targets, current: target}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if !canRetry(req) {
+		return resp, err
+	}
+
+	deadline := time.Now().Add(t.route.retryMaxTime())
+	backoff := t.route.retryBackoff()
+	for attempt := 1; attempt <= t.route.retryAttempts() && t.shouldRetry(req, resp, err); attempt++ {
+		if time.Now().Add(backoff).After(deadline) {
+			break
+		}
+
+		// Send the retry elsewhere while the target recovers
+		t.targets.markFailed(t.current)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return resp, err
+		}
+		backoff *= 2
+
+		target, ok := t.targets.acquire()
+		if !ok {
+			break
+		}
+		t.acquired = append(t.acquired, target)
+
+		if err != nil {
+			logger.Warnf("Retrying %s on route %s after %v from %s: attempt %d to %s",
+				logRedactor.URL(req.URL), t.route.label(), err, t.current, attempt, target)
+		} else {
+			logger.Warnf("Retrying %s on route %s after status %d from %s: attempt %d to %s",
+				logRedactor.URL(req.URL), t.route.label(), resp.StatusCode, t.current, attempt, target)
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		out := req.Clone(req.Context())
+		out.URL.Host = target.String()
+		if req.GetBody != nil {
+			if out.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		t.current = target
+		resp, err = t.next.RoundTrip(out)
+	}
+	return resp, err
+}
+
+// canRetry reports whether the request may be sent more than once. Bodies are consumed by the first
+// attempt, so requests with one are only sent again when it was buffered, which also marks the route's
+// writes as safe to repeat.
+func canRetry(req *http.Request) bool {
+	if req.GetBody != nil {
+		return true
+	}
+	return retryableMethod(req.Method) && (req.Body == nil || req.Body == http.NoBody)
+}
+
+// shouldRetry reports whether the outcome of the latest attempt is retried, requests of clients that went
+// away are not
+func (t *retryTransport) shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		return req.Context().Err() == nil
+	}
+	return slices.Contains(t.route.RetryOnStatus, resp.StatusCode)
+}
+
+// release frees the connection slots reserved for retries
+func (t *retryTransport) release() {
+	for _, target := range t.acquired {
+		t.targets.release(target)
+	}
+}
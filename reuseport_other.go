@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package router
+
+import (
+	"errors"
+	"syscall"
+)
+
+// reusePort fails on platforms without SO_REUSEPORT
+func reusePort(network, address string, conn syscall.RawConn) error {
+	return errors.New("reuse_port is not supported on this platform")
+}
@@ -0,0 +1,272 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/netutil"
+)
+
+// Router serves the servers of a config until its context is cancelled, then shuts them down gracefully
+// and runs the hooks registered by the code embedding it
+type Router struct {
+	config Config
+	load   func() (Config, error) // Reads the config again on reload
+
+	// shutdown is cancelled once the graceful shutdown begins, closing the connections the servers do not
+	// track such as WebSocket bridges
+	shutdown      context.Context
+	beginShutdown context.CancelFunc
+
+	hooksMu sync.Mutex
+	hooks   []func(ctx context.Context)
+	done    chan struct{}
+}
+
+// New returns a router serving the config. Reloads through SIGHUP or the admin server apply the same
+// config again, e.g. to pick up rotated certificates.
+func New(config Config) *Router {
+	return newRouter(config, func() (Config, error) { return config, nil })
+}
+
+// newRouter returns a router serving the config, reloading it from load
+func newRouter(config Config, load func() (Config, error)) *Router {
+	shutdown, beginShutdown := context.WithCancel(context.Background())
+	return &Router{
+		config:        config,
+		load:          load,
+		shutdown:      shutdown,
+		beginShutdown: beginShutdown,
+		done:          make(chan struct{}),
+	}
+}
+
+// Run starts the servers of the config and serves them until the context is cancelled, then shuts them down
+// gracefully and runs the shutdown hooks. It returns an error when the config is invalid or a port cannot be
+// bound, nothing is served then. While running, SIGHUP reloads the config and SIGUSR1 logs statistics.
+func (rt *Router) Run(ctx context.Context) error {
+	// Report the router done even when it failed to start, so Wait does not block forever
+	defer rt.runShutdownHooks()
+	defer rt.beginShutdown()
+
+	// Expand environment variable references in config values
+	config := rt.config
+	config.expandEnv()
+
+	// Configure log destination and rotation
+	setupLogging(config.Logging)
+
+	// Share response copy buffers across all proxies
+	proxyBufferPool = newBufferPool(config.ProxyBufferSize)
+
+	// Merge server blocks sharing a port and prepare their routes
+	servers, err := prepareServers(config)
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	trustedProxies, err := parseTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	logger.Infof("Router %s", currentBuild())
+
+	// Log all servers and routes once, identified by the config fingerprint
+	logStartupSummary(config, servers)
+
+	// Channel to collect all server instances for graceful shutdown
+	httpServers := make([]*runningServer, 0, len(servers))
+	serversMutex := sync.Mutex{}
+
+	// Listeners bound for the servers and the functions serving them, started once every port is bound
+	var (
+		listeners []net.Listener
+		starts    []func()
+	)
+	closeListeners := func() {
+		for _, listener := range listeners {
+			_ = listener.Close()
+		}
+	}
+
+	// Routes of running servers, replaced on reload
+	live := make(map[int]*liveServer, len(servers))
+
+	// Readiness of this run, set once warmup completes
+	ready := &atomic.Bool{}
+
+	// Certificates of the HTTPS servers of this run, watched until the shutdown begins
+	certs := &certStores{}
+
+	// Bind every port before serving any, servers with port 0 or a port range only know their port afterwards
+	for _, serverCfg := range servers {
+		if !serverCfg.IsEnabled() {
+			logger.Warnf("Server on port %s is disabled, skipping", serverCfg.portLabel())
+			continue
+		}
+
+		listener, err := serverCfg.listen()
+		if err != nil {
+			closeListeners()
+			return fmt.Errorf("failed to start server on port %s: %w", serverCfg.portLabel(), err)
+		}
+		listeners = append(listeners, listener)
+		port := listener.Addr().(*net.TCPAddr).Port
+
+		// Name the server after the port it was bound to
+		if serverCfg.dynamicPort() && serverCfg.ServedBy {
+			serverCfg.buildRoutes(config.ServerName, port)
+		}
+
+		current := &liveServer{}
+		current.Store(&serverCfg)
+		if !serverCfg.dynamicPort() {
+			live[serverCfg.Server] = current
+		}
+
+		// Count requests in flight to report draining progress on shutdown
+		active := &atomic.Int64{}
+		handler := newServerHandler(current, trustedProxies, active, ready, rt.shutdown)
+		if serverCfg.MaxConnsPerIP > 0 {
+			listener = limitConnectionsPerIP(listener, serverCfg.MaxConnsPerIP)
+		}
+		if serverCfg.MaxConnections > 0 {
+			listener = netutil.LimitListener(listener, serverCfg.MaxConnections)
+		}
+
+		// Configure server with proper shutdown
+		srv := &http.Server{
+			Addr:           fmt.Sprintf(":%d", port),
+			Handler:        handler,
+			MaxHeaderBytes: serverCfg.MaxHeaderBytes,
+		}
+
+		// Serve HTTPS with a certificate that is replaced when rotated, or obtained through ACME
+		serve := srv.Serve
+		if serverCfg.TLS.enabled() {
+			tlsConfig, err := serverCfg.TLS.newTLSConfig(rt.shutdown, certs)
+			if err != nil {
+				closeListeners()
+				return fmt.Errorf("failed to start server on port %d: %w", port, err)
+			}
+			srv.TLSConfig = tlsConfig
+			serve = func(l net.Listener) error { return srv.ServeTLS(l, "", "") }
+		}
+
+		httpServers = append(httpServers, &runningServer{port: port, srv: srv, active: active})
+		starts = append(starts, func() {
+			logger.Infof("Server starting on port %d", port)
+			if err := serve(listener); err != nil && err != http.ErrServerClosed {
+				logger.Errorf("Server on port %d failed: %v", port, err)
+				return
+			}
+			logger.Infof("Server on port %d has been shutdown", port)
+		})
+	}
+
+	// Reloads requested by SIGHUP and the admin server are serialized
+	reloads := &reloader{load: rt.load, live: live, certs: certs}
+
+	// Serve the admin endpoints, shut down along with the other servers
+	if config.Admin.enabled() {
+		srv := newAdminServer(config.Admin, reloads.reload, live, ready)
+		listener, err := net.Listen("tcp", srv.Addr)
+		if err != nil {
+			closeListeners()
+			return fmt.Errorf("failed to start admin server on %s: %w", srv.Addr, err)
+		}
+		listeners = append(listeners, listener)
+		httpServers = append(httpServers, &runningServer{port: config.Admin.Port, srv: srv, active: &atomic.Int64{}})
+		starts = append(starts, func() {
+			logger.Infof("Admin server starting on %s", srv.Addr)
+			if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
+				logger.Errorf("Admin server on %s failed: %v", srv.Addr, err)
+			}
+		})
+	}
+
+	// Surface unreachable backends without delaying startup, warmup probes them until they are reachable
+	if config.Warmup.Enabled {
+		go warmup(servers, config.Warmup, ready)
+	} else {
+		ready.Store(true)
+		if config.CheckBackendsOnStart {
+			go checkBackends(servers)
+		}
+	}
+
+	for _, start := range starts {
+		go start()
+	}
+
+	// Reload the config and the certificates of HTTPS servers on SIGHUP
+	reloadSignal := make(chan os.Signal, 1)
+	signal.Notify(reloadSignal, syscall.SIGHUP)
+	defer signal.Stop(reloadSignal)
+	go func() {
+		for range reloadSignal {
+			logger.Infof("Received reload signal, reloading config and certificates...")
+			_ = reloads.reload()
+		}
+	}()
+
+	// Log runtime statistics on SIGUSR1
+	statsSignal := make(chan os.Signal, 1)
+	notifyStats(statsSignal)
+	defer signal.Stop(statsSignal)
+	go func() {
+		for range statsSignal {
+			logStats(httpServers, &serversMutex, config.StatsDumpFile)
+		}
+	}()
+
+	// Serve until the embedding code or a shutdown signal cancels the context
+	<-ctx.Done()
+	rt.beginShutdown()
+
+	// Create a timeout context for shutdown
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Shutdown all servers
+	shutdownWg := sync.WaitGroup{}
+	serversMutex.Lock()
+	for _, server := range httpServers {
+		shutdownWg.Add(1)
+		go func(s *http.Server) {
+			defer shutdownWg.Done()
+
+			if err := s.Shutdown(shutdownCtx); err != nil {
+				logger.Errorf("Error during server shutdown: %v", err)
+			}
+		}(server.srv)
+	}
+	serversMutex.Unlock()
+
+	// Wait for all servers to complete graceful shutdown
+	shutdownChan := make(chan struct{})
+	go func() {
+		shutdownWg.Wait()
+		close(shutdownChan)
+	}()
+
+	// Report requests still in flight while draining
+	go logDraining(httpServers, shutdownChan)
+
+	// Wait for either context timeout or all servers to shutdown
+	select {
+	case <-shutdownCtx.Done():
+		logger.Warnf("Shutdown timed out, forcing exit")
+	case <-shutdownChan:
+		logger.Infof("All servers gracefully shut down")
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package router
+
+import "net/http"
+
+// routeTrie indexes the routes of a server by path, so matching a request takes time proportional to the
+// length of its path instead of the number of routes
+type routeTrie struct {
+	routes []RedirectConfig
+	root   *trieNode
+}
+
+type trieNode struct {
+	children map[byte]*trieNode
+	routes   []int // Positions of the routes whose path ends at this node, in match order
+}
+
+// newRouteTrie indexes the routes, which are sorted by sortRoutes
+func newRouteTrie(routes []RedirectConfig) *routeTrie {
+	t := &routeTrie{routes: routes, root: &trieNode{}}
+	for i, route := range routes {
+		node := t.root
+		for j := 0; j < len(route.Path); j++ {
+			child, ok := node.children[route.Path[j]]
+			if !ok {
+				if node.children == nil {
+					node.children = make(map[byte]*trieNode)
+				}
+				child = &trieNode{}
+				node.children[route.Path[j]] = child
+			}
+			node = child
+		}
+		node.routes = append(node.routes, i)
+	}
+	return t
+}
+
+// match returns the first route in match order whose path is a prefix of the request path, whose match_headers
+// are present in the header and that accepts the method. When no such route accepts the method, the first route
+// matching the path and headers is returned so it can reject the method, callers must not serve it otherwise.
+func (t *routeTrie) match(method, path string, header http.Header) (RedirectConfig, bool) {
+	accepted, fallback := -1, -1
+	node := t.root
+	for i := 0; ; i++ {
+		for _, j := range node.routes {
+			if !t.routes[j].matchesHeaders(header) {
+				continue
+			}
+			if fallback == -1 || j < fallback {
+				fallback = j
+			}
+			if (accepted == -1 || j < accepted) && t.routes[j].allowsMethod(method) {
+				accepted = j
+			}
+		}
+		if i == len(path) {
+			break
+		}
+		if node = node.children[path[i]]; node == nil {
+			break
+		}
+	}
+
+	switch {
+	case accepted != -1:
+		return t.routes[accepted], true
+	case fallback != -1:
+		return t.routes[fallback], true
+	default:
+		return RedirectConfig{}, false
+	}
+}
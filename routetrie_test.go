@@ -0,0 +1,92 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// linearMatch is the linear scan over the sorted routes the trie replaces, used as the reference
+func linearMatch(routes []RedirectConfig, method, path string, header http.Header) (RedirectConfig, bool) {
+	fallback := -1
+	for i, route := range routes {
+		if !strings.HasPrefix(path, route.Path) || !route.matchesHeaders(header) {
+			continue
+		}
+		if route.allowsMethod(method) {
+			return route, true
+		}
+		if fallback == -1 {
+			fallback = i
+		}
+	}
+	if fallback != -1 {
+		return routes[fallback], true
+	}
+	return RedirectConfig{}, false
+}
+
+// generateRoutes returns n sorted routes of distinct services below a catch-all route
+func generateRoutes(n int) []RedirectConfig {
+	routes := []RedirectConfig{{Path: "/"}}
+	for i := 0; i < n-1; i++ {
+		routes = append(routes, RedirectConfig{Path: fmt.Sprintf("/svc%04d/api", i)})
+	}
+	sortRoutes(routes)
+	return routes
+}
+
+func TestRouteTrieMatchesLinearScan(t *testing.T) {
+	routes := []RedirectConfig{
+		{Name: "root", Path: "/"},
+		{Name: "api", Path: "/api"},
+		{Name: "api-v2", Path: "/api/v2"},
+		{Name: "api-v2-post", Path: "/api/v2", Methods: []string{http.MethodPost}},
+		{Name: "api-v2-tenant", Path: "/api/v2", MatchHeaders: map[string]string{"X-Tenant": "acme"}},
+		{Name: "priority", Path: "/static", Priority: 10},
+		{Name: "static-images", Path: "/static/images"},
+		{Name: "get-only", Path: "/get", Methods: []string{http.MethodGet}},
+	}
+	sortRoutes(routes)
+	trie := newRouteTrie(routes)
+
+	tenant := http.Header{"X-Tenant": {"acme"}}
+	for _, path := range []string{"/", "/api", "/api/", "/apix", "/api/v2", "/api/v2/users", "/static/images/a.png", "/get", "/other"} {
+		for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodDelete} {
+			for _, header := range []http.Header{nil, tenant} {
+				got, gotOK := trie.match(method, path, header)
+				want, wantOK := linearMatch(routes, method, path, header)
+				if gotOK != wantOK || got.Name != want.Name {
+					t.Errorf("%s %s %v: trie matched %q, linear scan %q", method, path, header, got.Name, want.Name)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkRouteMatch(b *testing.B) {
+	for _, n := range []int{500, 1000} {
+		routes := generateRoutes(n)
+		trie := newRouteTrie(routes)
+		paths := make([]string, 0, 64)
+		for i := 0; i < cap(paths); i++ {
+			paths = append(paths, fmt.Sprintf("/svc%04d/api/users/%d", i*(n-1)/cap(paths), i))
+		}
+
+		b.Run(fmt.Sprintf("trie/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, ok := trie.match(http.MethodGet, paths[i%len(paths)], nil); !ok {
+					b.Fatal("no route matched")
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("linear/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, ok := linearMatch(routes, http.MethodGet, paths[i%len(paths)], nil); !ok {
+					b.Fatal("no route matched")
+				}
+			}
+		})
+	}
+}
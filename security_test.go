@@ -0,0 +1,19 @@
+package router
+
+import "testing"
+
+func TestSecurityHeadersCSP(t *testing.T) {
+	if csp := (SecurityHeadersConfig{Enabled: true}).headers().Get("Content-Security-Policy"); csp == "" {
+		t.Error("expected a default Content-Security-Policy")
+	}
+
+	custom := SecurityHeadersConfig{Enabled: true, Headers: map[string]string{"Content-Security-Policy": "default-src 'self'"}}
+	if csp := custom.headers().Get("Content-Security-Policy"); csp != "default-src 'self'" {
+		t.Errorf("got %q, want the configured policy", csp)
+	}
+
+	dropped := SecurityHeadersConfig{Enabled: true, Headers: map[string]string{"Content-Security-Policy": ""}}
+	if values := dropped.headers().Values("Content-Security-Policy"); len(values) != 0 {
+		t.Errorf("got %q, want the default dropped by an empty value", values)
+	}
+}
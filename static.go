@@ -0,0 +1,35 @@
+package router
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// newStaticHandler serves files of the route's static directory with the route prefix stripped.
+// With SPA fallback enabled, paths that do not exist serve index.html so client-side routing works.
+func newStaticHandler(route RedirectConfig) http.Handler {
+	prefix := strings.TrimSuffix(route.Path, "/")
+	dir := http.Dir(route.StaticDir)
+	fileServer := http.StripPrefix(prefix, http.FileServer(dir))
+	if !route.SPA {
+		return fileServer
+	}
+
+	index := filepath.Join(route.StaticDir, "index.html")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + strings.TrimPrefix(r.URL.Path, prefix))
+		file, err := dir.Open(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			http.ServeFile(w, r, index)
+			return
+		}
+		if err == nil {
+			_ = file.Close()
+		}
+		fileServer.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,42 @@
+package router
+
+import (
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+)
+
+// Number of WebSocket bridges currently forwarding messages
+var activeBridges atomic.Int64
+
+// logStats logs runtime and connection statistics, and writes a goroutine dump when a file is configured
+func logStats(servers []*runningServer, mu *sync.Mutex, dumpFile string) {
+	logger.Infof("Goroutines: %d, active WebSocket bridges: %d",
+		runtime.NumGoroutine(), activeBridges.Load())
+
+	mu.Lock()
+	for _, server := range servers {
+		logger.Infof("Server on port %d: %d requests in flight",
+			server.port, server.active.Load())
+	}
+	mu.Unlock()
+
+	if len(dumpFile) == 0 {
+		return
+	}
+
+	file, err := os.Create(dumpFile)
+	if err != nil {
+		logger.Errorf("Failed to create goroutine dump file: %v", err)
+		return
+	}
+	defer file.Close()
+
+	if err := pprof.Lookup("goroutine").WriteTo(file, 2); err != nil {
+		logger.Errorf("Failed to write goroutine dump: %v", err)
+		return
+	}
+	logger.Infof("Goroutine dump written to %s", dumpFile)
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package router
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyStats relays the statistics signal (SIGUSR1) to the channel
+func notifyStats(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR1)
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package router
+
+import (
+	"os"
+)
+
+// notifyStats does nothing on Windows, which has no SIGUSR1
+func notifyStats(c chan<- os.Signal) {}
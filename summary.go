@@ -0,0 +1,69 @@
+package router
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// configFingerprint returns a short hash of the effective config, it changes whenever the loaded config does
+func configFingerprint(config Config) string {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "unknown"
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// logStartupSummary logs every server and route of the config in a single entry along with the config fingerprint
+func logStartupSummary(config Config, servers []ServerConfig) {
+	writer := strings.Builder{}
+	writer.WriteString(fmt.Sprintf("%sLoaded config %s%s%s with the following servers:",
+		ColorGreen, ColorCyan, configFingerprint(config), ColorReset))
+	for _, server := range servers {
+		if !server.IsEnabled() {
+			writer.WriteString(fmt.Sprintf("\n  %sport %s (disabled)%s", ColorYellow, server.portLabel(), ColorReset))
+			continue
+		}
+
+		writer.WriteString(fmt.Sprintf("\n  %sport %s%s%s", ColorGreen, ColorCyan, server.portLabel(), ColorReset))
+		for _, route := range server.Redirect {
+			if route.static != nil {
+				writer.WriteString(fmt.Sprintf("\n\t%s%s%s -> %sstatic %s%s",
+					ColorYellow, route.Path, ColorReset,
+					ColorGreen, route.StaticDir, ColorReset))
+				continue
+			}
+			writer.WriteString(fmt.Sprintf("\n\t%s%s%s -> %s%s%s",
+				ColorYellow, route.Path, ColorReset,
+				ColorGreen, joinTargets(route.balancer.targets), ColorReset))
+			if len(route.Name) != 0 {
+				writer.WriteString(fmt.Sprintf(" %s[%s]%s", ColorBlue, route.Name, ColorReset))
+			}
+			if route.LogBodies.Enabled {
+				writer.WriteString(fmt.Sprintf(" %s(logging bodies)%s", ColorRed, ColorReset))
+			}
+			if route.canary != nil {
+				writer.WriteString(fmt.Sprintf(" %s(canary %g%%: %s)%s",
+					ColorPurple, route.Canary.Percent, joinTargets(route.canary.targets), ColorReset))
+			}
+		}
+	}
+	summary := writer.String()
+	if _, ok := logger.(stdLogger); !ok {
+		summary = colorCodes.ReplaceAllString(summary, "")
+	}
+	logger.Infof("%s", summary)
+}
+
+// joinTargets formats the targets as a comma separated list
+func joinTargets(targets []TargetConfig) string {
+	addresses := make([]string, 0, len(targets))
+	for _, target := range targets {
+		addresses = append(addresses, target.String())
+	}
+	return strings.Join(addresses, ", ")
+}
@@ -0,0 +1,266 @@
+package router
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// Interval between checks of the certificate files for changes when not configured
+const defaultCertReloadInterval = time.Minute
+
+// TLSConfig serves a server over HTTPS
+type TLSConfig struct {
+	CertFile string `mapstructure:"cert_file"` // PEM certificate chain
+	KeyFile  string `mapstructure:"key_file"`  // PEM private key
+
+	// Interval between checks of the files for changes, defaults to 1m, negative values disable the checks
+	ReloadInterval time.Duration `mapstructure:"reload_interval"`
+
+	// Ports of a server listing ports that serve HTTPS, the others serve HTTP, all ports when empty
+	Ports []int `mapstructure:"ports"`
+
+	// PEM CA certificates client certificates are verified against, clients without one are still accepted
+	ClientCAFile string `mapstructure:"client_ca_file"`
+	// Reject TLS handshakes of clients without a certificate signed by one of the client CAs
+	RequireClientCert bool `mapstructure:"require_client_cert"`
+
+	// Obtain certificates through ACME instead of cert_file and key_file
+	Autocert AutocertConfig `mapstructure:"autocert"`
+
+	MinVersion   string   `mapstructure:"min_version"`   // Oldest accepted protocol version, 1.2 (default) or 1.3
+	CipherSuites []string `mapstructure:"cipher_suites"` // TLS 1.2 cipher suites by name, Go's secure defaults when empty
+}
+
+// TLS protocol versions accepted by min_version
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// minVersion returns the oldest protocol version the server accepts
+func (t TLSConfig) minVersion() uint16 {
+	if version, ok := tlsVersions[t.MinVersion]; ok {
+		return version
+	}
+	return tls.VersionTLS12
+}
+
+// cipherSuites returns the IDs of the configured cipher suites, only suites without known weaknesses are accepted
+func (t TLSConfig) cipherSuites() ([]uint16, error) {
+	var ids []uint16
+	for _, name := range t.CipherSuites {
+		i := slices.IndexFunc(tls.CipherSuites(), func(suite *tls.CipherSuite) bool { return suite.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("tls cipher suite %q is unknown or insecure", name)
+		}
+		ids = append(ids, tls.CipherSuites()[i].ID)
+	}
+	return ids, nil
+}
+
+// enabled reports whether the server terminates TLS
+func (t TLSConfig) enabled() bool {
+	return len(t.CertFile) != 0 || len(t.KeyFile) != 0 || len(t.ClientCAFile) != 0 || t.RequireClientCert || t.Autocert.Enabled
+}
+
+// validate checks that either both the certificate and the key or autocert are configured
+func (t TLSConfig) validate() error {
+	if t.Autocert.Enabled {
+		if len(t.CertFile) != 0 || len(t.KeyFile) != 0 {
+			return errors.New("tls sets both autocert and cert_file or key_file")
+		}
+		if err := t.Autocert.validate(); err != nil {
+			return err
+		}
+	} else if len(t.CertFile) == 0 || len(t.KeyFile) == 0 {
+		return errors.New("tls requires both cert_file and key_file")
+	}
+	if t.RequireClientCert && len(t.ClientCAFile) == 0 {
+		return errors.New("tls require_client_cert requires client_ca_file")
+	}
+	if _, ok := tlsVersions[t.MinVersion]; !ok && len(t.MinVersion) != 0 {
+		return fmt.Errorf("invalid tls min_version %q, expected 1.2 or 1.3", t.MinVersion)
+	}
+	if _, err := t.cipherSuites(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// newTLSConfig returns the TLS config of a server with the configured protocol versions and cipher suites,
+// serving the certificate files, reloaded when they change, or the certificates obtained through ACME.
+// Certificate files are registered in stores and watched until ctx is cancelled. Client certificates are
+// verified against the client CAs when configured.
+func (t TLSConfig) newTLSConfig(ctx context.Context, stores *certStores) (*tls.Config, error) {
+	// Validated by prepareServers
+	cipherSuites, _ := t.cipherSuites()
+	cfg := &tls.Config{
+		MinVersion:   t.minVersion(),
+		CipherSuites: cipherSuites,
+	}
+	if t.Autocert.Enabled {
+		cfg.GetCertificate = t.Autocert.manager().GetCertificate
+		cfg.NextProtos = []string{"h2", "http/1.1", acme.ALPNProto}
+	} else {
+		store, err := stores.add(t)
+		if err != nil {
+			return nil, err
+		}
+		go store.watch(ctx, t.ReloadInterval)
+		cfg.GetCertificate = store.getCertificate
+	}
+
+	if len(t.ClientCAFile) == 0 {
+		return cfg, nil
+	}
+
+	pem, err := os.ReadFile(t.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("load client CAs: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("load client CAs: no certificates found in %s", t.ClientCAFile)
+	}
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	if t.RequireClientCert {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// certStores holds the certificates of the HTTPS servers of a run, reloaded together on SIGHUP
+type certStores struct {
+	mu     sync.Mutex
+	stores []*certStore
+}
+
+// add loads the certificate of the config and registers it for reloading
+func (c *certStores) add(cfg TLSConfig) (*certStore, error) {
+	s, err := newCertStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.stores = append(c.stores, s)
+	c.mu.Unlock()
+	return s, nil
+}
+
+// reload reloads the certificates of all HTTPS servers
+func (c *certStores) reload() {
+	c.mu.Lock()
+	stores := append([]*certStore(nil), c.stores...)
+	c.mu.Unlock()
+
+	for _, s := range stores {
+		s.reloadLogged()
+	}
+}
+
+// certStore serves the current certificate of a server, replaced whenever the files change so
+// rotated certificates take effect without restarting and dropping connections
+type certStore struct {
+	certFile string
+	keyFile  string
+
+	cert    atomic.Pointer[tls.Certificate]
+	mu      sync.Mutex
+	modTime time.Time
+}
+
+// newCertStore loads the certificate of the config
+func newCertStore(cfg TLSConfig) (*certStore, error) {
+	s := &certStore{certFile: cfg.CertFile, keyFile: cfg.KeyFile}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// getCertificate returns the current certificate for every TLS handshake
+func (s *certStore) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return s.cert.Load(), nil
+}
+
+// reload reads the certificate files, the previous certificate stays in use when they are invalid
+func (s *certStore) reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	modTime, err := s.filesModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate %s: %w", s.certFile, err)
+	}
+	s.cert.Store(&cert)
+	s.modTime = modTime
+	return nil
+}
+
+// filesModTime returns the latest modification time of the certificate and key files
+func (s *certStore) filesModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{s.certFile, s.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// watch reloads the certificate whenever its files were modified, checking every interval until ctx is cancelled
+func (s *certStore) watch(ctx context.Context, interval time.Duration) {
+	if interval == 0 {
+		interval = defaultCertReloadInterval
+	}
+	if interval < 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		modTime, err := s.filesModTime()
+		changed := err == nil && !modTime.Equal(s.modTime)
+		s.mu.Unlock()
+		if changed {
+			s.reloadLogged()
+		}
+	}
+}
+
+// reloadLogged reloads the certificate and logs the outcome
+func (s *certStore) reloadLogged() {
+	if err := s.reload(); err != nil {
+		logger.Errorf("Failed to reload certificate, keeping the current one: %v", err)
+		return
+	}
+	logger.Infof("Reloaded certificate %s", s.certFile)
+}
@@ -0,0 +1,130 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultTransformTimeout = 5 * time.Second
+	defaultTransformMaxSize = 1 << 20
+)
+
+var (
+	// errTransform marks proxy errors caused by a transform command rather than the backend
+	errTransform = errors.New("transform failed")
+	// errTransformTooLarge is returned for bodies above the transform size limit
+	errTransformTooLarge = errors.New("body too large to transform")
+)
+
+// TransformConfig pipes request or response bodies of a route through external commands.
+// Commands only run when allow_transforms is set at the top level of the config.
+type TransformConfig struct {
+	Request  []string      `mapstructure:"request"`  // Command and arguments the request body is piped through
+	Response []string      `mapstructure:"response"` // Command and arguments the response body is piped through
+	Timeout  time.Duration `mapstructure:"timeout"`  // Deadline of each command run, defaults to 5s
+	MaxSize  int64         `mapstructure:"max_size"` // Largest body transformed in bytes, defaults to 1MiB
+}
+
+// enabled reports whether the route transforms any body
+func (t TransformConfig) enabled() bool {
+	return len(t.Request) != 0 || len(t.Response) != 0
+}
+
+func (t TransformConfig) maxSize() int64 {
+	if t.MaxSize <= 0 {
+		return defaultTransformMaxSize
+	}
+	return t.MaxSize
+}
+
+// run feeds the body to the command on stdin and returns its stdout, failing when the command
+// exits with an error, exceeds the timeout or writes more than the size limit
+func (t TransformConfig) run(ctx context.Context, command []string, body []byte) ([]byte, error) {
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = defaultTransformTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stdout = &limitedBuffer{buf: &stdout, limit: t.maxSize()}
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v: %s", errTransform, command[0], err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// readBody reads a body to transform, failing when it exceeds the size limit
+func (t TransformConfig) readBody(body io.ReadCloser) ([]byte, error) {
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, t.maxSize()+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > t.maxSize() {
+		return nil, fmt.Errorf("%w: %w: limit is %d bytes", errTransform, errTransformTooLarge, t.maxSize())
+	}
+	return data, nil
+}
+
+// transformRequest replaces the request body with the output of the request command. Requests without a body,
+// such as most GET and HEAD requests, are forwarded without running the command.
+func (t TransformConfig) transformRequest(r *http.Request) error {
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		return nil
+	}
+	body, err := t.readBody(r.Body)
+	if err != nil {
+		return err
+	}
+	out, err := t.run(r.Context(), t.Request, body)
+	if err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(out))
+	r.ContentLength = int64(len(out))
+	r.Header.Del("Transfer-Encoding")
+	return nil
+}
+
+// transformResponse replaces the response body with the output of the response command
+func (t TransformConfig) transformResponse(resp *http.Response) error {
+	body, err := t.readBody(resp.Body)
+	if err != nil {
+		return err
+	}
+	out, err := t.run(resp.Request.Context(), t.Response, body)
+	if err != nil {
+		return err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(out))
+	resp.ContentLength = int64(len(out))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(out)))
+	resp.Header.Del("Transfer-Encoding")
+	return nil
+}
+
+// limitedBuffer fails writes that would grow the buffer past the limit
+type limitedBuffer struct {
+	buf   *bytes.Buffer
+	limit int64
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if int64(b.buf.Len()+len(p)) > b.limit {
+		return 0, fmt.Errorf("output exceeds %d bytes", b.limit)
+	}
+	return b.buf.Write(p)
+}
@@ -0,0 +1,33 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTransformRequestWithoutBody(t *testing.T) {
+	// A failing command shows whether it ran
+	failing := TransformConfig{Request: []string{"false"}}
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		r := httptest.NewRequest(method, "/", nil)
+		if err := failing.transformRequest(r); err != nil {
+			t.Errorf("%s without body: command ran: %v", method, err)
+		}
+	}
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}"))
+	if err := failing.transformRequest(r); err == nil {
+		t.Error("POST with body: command did not run")
+	}
+
+	upper := TransformConfig{Request: []string{"tr", "a-z", "A-Z"}}
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("body"))
+	if err := upper.transformRequest(r); err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(r.Body); string(body) != "BODY" || r.ContentLength != 4 {
+		t.Errorf("got body %q of length %d, want %q", body, r.ContentLength, "BODY")
+	}
+}
@@ -0,0 +1,70 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// Path of the build information endpoint of servers with version enabled
+const versionPath = "/version"
+
+// Build information, set at build time with
+// -ldflags "-X github.com/yanun0323/router.version=v1.2.3 -X github.com/yanun0323/router.commit=abc1234 -X github.com/yanun0323/router.buildDate=2024-01-01T00:00:00Z"
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// buildInfo identifies the running binary
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// currentBuild returns the build information of the binary, falling back to the VCS details
+// recorded by the Go toolchain when they were not set through -ldflags
+func currentBuild() buildInfo {
+	info := buildInfo{Version: version, Commit: commit, BuildDate: buildDate, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && len(info.Commit) == 0:
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && len(info.BuildDate) == 0:
+				info.BuildDate = setting.Value
+			}
+		}
+	}
+	return info
+}
+
+// String formats the build information on a single line
+func (b buildInfo) String() string {
+	s := b.Version
+	if len(b.Commit) != 0 {
+		s += " (commit " + b.Commit
+		if len(b.BuildDate) != 0 {
+			s += ", built " + b.BuildDate
+		}
+		s += ")"
+	}
+	return s + " " + b.GoVersion
+}
+
+// runVersion prints the build information of the binary
+func runVersion(out io.Writer) {
+	fmt.Fprintf(out, "router %s\n", currentBuild())
+}
+
+// versionHandler serves the build information as JSON
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(currentBuild())
+}
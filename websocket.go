@@ -0,0 +1,147 @@
+package router
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsTraffic counts the messages and bytes forwarded in one direction of a WebSocket bridge
+type wsTraffic struct {
+	messages atomic.Int64
+	bytes    atomic.Int64
+}
+
+// add records a forwarded message
+func (t *wsTraffic) add(message []byte) {
+	t.messages.Add(1)
+	t.bytes.Add(int64(len(message)))
+}
+
+// Reasons a WebSocket bridge is closed by the router, sent to both peers in the close frame
+var (
+	errBridgeClosed = errors.New("bridge closed")
+	errBridgeIdle   = errors.New("idle timeout")
+	errRouteRetired = errors.New("route reconfigured")
+	errShuttingDown = errors.New("router shutting down")
+)
+
+// wsBridge forwards messages between the client and backend legs of a WebSocket connection. Cancelling
+// its context closes both legs with a close frame stating the cause, which ends both forwarding loops.
+type wsBridge struct {
+	client *websocket.Conn
+	target *websocket.Conn
+
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	upstream   wsTraffic // Client to backend
+	downstream wsTraffic // Backend to client
+	lastActive atomic.Int64
+}
+
+func newWSBridge(client, target *websocket.Conn) *wsBridge {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	b := &wsBridge{client: client, target: target, ctx: ctx, cancel: cancel}
+	b.touch()
+	return b
+}
+
+// run forwards messages until the backend leg closes or the bridge is cancelled, bridges no message
+// crossed for idleTimeout are cancelled unless it is zero
+func (b *wsBridge) run(idleTimeout time.Duration) {
+	// Unregistered before the bridge is cancelled on return, so a bridge ending normally is not closed twice
+	defer b.cancel(errBridgeClosed)
+	stop := context.AfterFunc(b.ctx, b.close)
+	defer stop()
+
+	if idleTimeout > 0 {
+		go b.cancelWhenIdle(idleTimeout)
+	}
+	go b.forward(b.client, b.target, &b.upstream, "client", "server")
+	b.forward(b.target, b.client, &b.downstream, "server", "client")
+}
+
+// forward copies messages from one leg to the other until reading or writing fails
+func (b *wsBridge) forward(from, to *websocket.Conn, traffic *wsTraffic, source, destination string) {
+	for {
+		messageType, message, err := from.ReadMessage()
+		if err != nil {
+			// Reads of a cancelled bridge fail because the router closed the connections
+			if b.ctx.Err() == nil {
+				logger.Errorf("Read from %s failed: %v", source, err)
+				relayClose(to, err)
+			}
+			return
+		}
+		if err := to.WriteMessage(messageType, message); err != nil {
+			if b.ctx.Err() == nil {
+				logger.Errorf("Write to %s failed: %v", destination, err)
+			}
+			return
+		}
+		traffic.add(message)
+		b.touch()
+	}
+}
+
+// close sends a close frame stating the cancellation cause to both legs and closes them
+func (b *wsBridge) close() {
+	cause := context.Cause(b.ctx)
+	logger.Warnf("Closing WebSocket bridge: %v", cause)
+	message := websocket.FormatCloseMessage(websocket.CloseGoingAway, cause.Error())
+	for _, conn := range []*websocket.Conn{b.client, b.target} {
+		_ = conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+		_ = conn.Close()
+	}
+}
+
+// touch records a forwarded message
+func (b *wsBridge) touch() {
+	b.lastActive.Store(time.Now().UnixNano())
+}
+
+// cancelWhenIdle cancels the bridge once no message was forwarded in either direction for the timeout
+func (b *wsBridge) cancelWhenIdle(timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		if idle := time.Since(time.Unix(0, b.lastActive.Load())); idle < timeout {
+			timer.Reset(timeout - idle)
+			continue
+		}
+		b.cancel(errBridgeIdle)
+		return
+	}
+}
+
+// checkUpgrade validates the client handshake like the upgrader does, so no backend connection is dialed
+// for a client whose upgrade would fail. It returns the status the request should be rejected with.
+func checkUpgrade(w http.ResponseWriter, r *http.Request) (int, error) {
+	if r.Method != http.MethodGet {
+		return http.StatusMethodNotAllowed, errors.New("request method is not GET")
+	}
+	if strings.TrimSpace(r.Header.Get("Sec-Websocket-Version")) != "13" {
+		return http.StatusUpgradeRequired, errors.New("unsupported Sec-WebSocket-Version")
+	}
+	key, err := base64.StdEncoding.DecodeString(r.Header.Get("Sec-Websocket-Key"))
+	if err != nil || len(key) != 16 {
+		return http.StatusBadRequest, errors.New("missing or invalid Sec-WebSocket-Key")
+	}
+	if _, ok := w.(http.Hijacker); !ok {
+		return http.StatusInternalServerError, errors.New("connection does not support hijacking")
+	}
+	return 0, nil
+}
@@ -0,0 +1,168 @@
+package router
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// failingHijacker accepts the handshake checks but fails to hijack the client connection
+type failingHijacker struct {
+	*httptest.ResponseRecorder
+}
+
+func (failingHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errors.New("hijack failed")
+}
+
+// newWebSocketRequest returns a valid WebSocket handshake request for the path
+func newWebSocketRequest(path string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Sec-WebSocket-Version", "13")
+	r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	return r
+}
+
+func TestWebSocketClientUpgradeFailure(t *testing.T) {
+	var dials atomic.Int64
+	closed := make(chan error, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Upgrade(w, r, nil, 0, 0)
+		if err != nil {
+			return
+		}
+		dials.Add(1)
+		defer conn.Close()
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, _, err = conn.ReadMessage()
+		closed <- err
+	}))
+	defer backend.Close()
+
+	addr := backend.Listener.Addr().(*net.TCPAddr)
+	server := prepareServer(t, Config{Router: []ServerConfig{{
+		Server:   8080,
+		Redirect: []RedirectConfig{{Path: "/", Host: "127.0.0.1", Port: addr.Port}},
+	}}})
+	route := server.Redirect[0]
+
+	// Handshakes the upgrader would reject are refused before any backend is dialed
+	invalid := newWebSocketRequest("/ws")
+	invalid.Header.Del("Sec-WebSocket-Key")
+	rec := httptest.NewRecorder()
+	handleWebSocket(rec, invalid, route, context.Background())
+	if rec.Code != http.StatusBadRequest || dials.Load() != 0 {
+		t.Fatalf("got status %d after %d backend dials, want 400 without dialing", rec.Code, dials.Load())
+	}
+
+	// A client upgrade failing after the backend was dialed closes the backend connection
+	rec = httptest.NewRecorder()
+	handleWebSocket(failingHijacker{rec}, newWebSocketRequest("/ws"), route, context.Background())
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d, want 500", rec.Code)
+	}
+	select {
+	case err := <-closed:
+		if !websocket.IsCloseError(err, websocket.CloseGoingAway) || !strings.Contains(err.Error(), "client upgrade failed") {
+			t.Errorf("backend read %v, want a going away close frame", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("backend connection not closed")
+	}
+	if dials.Load() != 1 {
+		t.Errorf("got %d backend dials, want 1", dials.Load())
+	}
+	if inFlight := route.balancer.inFlight[route.balancer.targets[0]].Load(); inFlight != 0 {
+		t.Errorf("got %d connections in flight to the target, want 0", inFlight)
+	}
+}
+
+func TestWebSocketMethodNotAllowed(t *testing.T) {
+	var dials atomic.Int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dials.Add(1)
+		if conn, err := websocket.Upgrade(w, r, nil, 0, 0); err == nil {
+			_ = conn.Close()
+		}
+	}))
+	defer backend.Close()
+
+	addr := backend.Listener.Addr().(*net.TCPAddr)
+	server := prepareServer(t, Config{Router: []ServerConfig{{
+		Server: 8080,
+		Redirect: []RedirectConfig{{
+			Path:    "/",
+			Host:    "127.0.0.1",
+			Port:    addr.Port,
+			Methods: []string{"post", "put"},
+		}},
+	}}})
+
+	rec := httptest.NewRecorder()
+	handleWebSocket(rec, newWebSocketRequest("/ws"), server.Redirect[0], context.Background())
+	if rec.Code != http.StatusMethodNotAllowed || dials.Load() != 0 {
+		t.Fatalf("got status %d after %d backend dials, want 405 without dialing", rec.Code, dials.Load())
+	}
+	if allow := rec.Header().Get("Allow"); allow != "POST, PUT" {
+		t.Errorf("got Allow %q, want %q", allow, "POST, PUT")
+	}
+}
+
+func TestWebSocketSharedPath(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, err := websocket.Upgrade(w, r, nil, 0, 0)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(name))
+		}))
+	}
+	posts, upgrades := newBackend("post"), newBackend("get")
+	defer posts.Close()
+	defer upgrades.Close()
+
+	server := prepareServer(t, Config{Router: []ServerConfig{{
+		Server: 8080,
+		Redirect: []RedirectConfig{
+			{Path: "/ws", Host: "127.0.0.1", Port: posts.Listener.Addr().(*net.TCPAddr).Port, Methods: []string{"POST"}},
+			{Path: "/ws", Host: "127.0.0.1", Port: upgrades.Listener.Addr().(*net.TCPAddr).Port, Methods: []string{"GET"}},
+		},
+	}}})
+	front := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleRequest(w, r, server.routes, server.NotFound, context.Background())
+	}))
+	defer front.Close()
+
+	// The GET upgrade is bridged to the route accepting GET
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(front.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, message, err := conn.ReadMessage(); err != nil || string(message) != "get" {
+		t.Errorf("read %q, %v, want the GET route's backend", message, err)
+	}
+
+	// An upgrade with a method neither route accepts is matched to the POST route only to be rejected
+	r := newWebSocketRequest("/ws")
+	r.Method = http.MethodPut
+	rec := httptest.NewRecorder()
+	handleRequest(rec, r, server.routes, server.NotFound, context.Background())
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "POST" {
+		t.Errorf("got %d with Allow %q, want 405 with Allow %q", rec.Code, rec.Header().Get("Allow"), "POST")
+	}
+}